@@ -26,12 +26,15 @@ import (
 )
 
 var (
-	awsfile string
+	awsfile   string
+	awsRegion string
 )
 
 func init() {
 	awsCmd.PersistentFlags().StringVarP(&awsfile,
 		"awsfile", "f", "", "file is a path to save benchmark results")
+	awsCmd.PersistentFlags().StringVarP(&awsRegion,
+		"region", "", "us-east-1", "the aws region to provision resources in")
 	RootCmd.AddCommand(awsCmd)
 }
 
@@ -22,8 +22,7 @@ SOFTWARE.
 package cmd
 
 import (
-	"context"
-	"strings"
+	"time"
 
 	"github.com/deckarep/corebench/pkg/providers"
 	log "github.com/sirupsen/logrus"
@@ -31,25 +30,99 @@ import (
 )
 
 var (
-	keypair      string = "corebench"
 	instanceType string
+	benchFamily  string
+	awsZone      string
+	spot         bool
+	spotMaxPrice string
+	spotFallback bool
+	direct       bool
+	subnet       string
+	secGroup     string
 )
 
-// TODO: split out cores/instance types, map AMIs/regions/if HVM accordingly
-//       add cmds for stackname, region, keypair (?)
+// TODO: add cmds for stackname (?)
 func init() {
 	awsBenchCmd.PersistentFlags().StringVarP(&instanceType,
-		"instancetype", "", "t2.micro", "instance type to deploy (e.g. p2.xlarge)")
+		"instancetype", "", "", "instance type to deploy (e.g. p2.xlarge), defaults to the smallest of the --family that fits --cpu")
+	awsBenchCmd.PersistentFlags().StringVarP(&benchFamily,
+		"family", "", "c5", "the instance family to pick an instance type from when no --instancetype is given (e.g. c5, m5, c6g)")
+	awsBenchCmd.PersistentFlags().StringVarP(&cpu,
+		"cpu", "c", "", "every cpu of the instance by default, or a comma delimited list: -cpu=1,2,4,8")
+	awsBenchCmd.PersistentFlags().StringVarP(&awsZone,
+		"az", "", "", "the availability zone to deploy into, defaults to the first zone of the --region")
+	awsBenchCmd.PersistentFlags().BoolVarP(&spot,
+		"spot", "", false, "request the instance on the spot market instead of on-demand")
+	awsBenchCmd.PersistentFlags().StringVarP(&spotMaxPrice,
+		"spot-max-price", "", "", "the maximum $/HR to pay for a spot instance, defaults to the on-demand price")
+	awsBenchCmd.PersistentFlags().BoolVarP(&spotFallback,
+		"spot-fallback", "", false, "retry the benchmark on-demand if the spot instance is interrupted")
+	awsBenchCmd.PersistentFlags().BoolVarP(&direct,
+		"direct", "", false, "launch a single instance directly instead of provisioning a cloudformation stack")
+	awsBenchCmd.PersistentFlags().StringVarP(&subnet,
+		"subnet", "", "", "the subnet to launch into with --direct, defaults to the default vpc subnet of the --az")
+	awsBenchCmd.PersistentFlags().StringVarP(&secGroup,
+		"security-group", "", "", "the security group to launch into with --direct, one allowing ssh is created by default")
 	awsBenchCmd.PersistentFlags().StringVarP(&regexString,
 		"regex", "", "", "a regex to filter bench tests by")
+	awsBenchCmd.PersistentFlags().StringSliceVarP(&packages,
+		"packages", "", nil, "the package patterns to benchmark relative to the package given, such as ./... or ./sub, comma delimited list")
+	awsBenchCmd.PersistentFlags().StringVarP(&benchTime,
+		"benchtime", "", "", "go test's -benchtime, how long each benchmark runs (2s) or how many iterations (100x)")
+	awsBenchCmd.PersistentFlags().DurationVarP(&testTimeout,
+		"timeout", "", 0, "go test's -timeout, go test's default of 10m when 0")
+	awsBenchCmd.PersistentFlags().StringSliceVarP(&tags,
+		"tags", "", nil, "the build tags to benchmark with, comma delimited list")
+	awsBenchCmd.PersistentFlags().StringVarP(&runRegex,
+		"run", "", "^$", "go test's -run, the tests are skipped by default and an empty value runs them all")
+	awsBenchCmd.PersistentFlags().BoolVarP(&short,
+		"short", "", false, "go test's -short")
+	awsBenchCmd.PersistentFlags().StringVarP(&gcFlags,
+		"gcflags", "", "", "go test's -gcflags")
+	awsBenchCmd.PersistentFlags().StringVarP(&ldFlags,
+		"ldflags", "", "", "go test's -ldflags")
+	awsBenchCmd.PersistentFlags().StringVarP(&sshCidr,
+		"ssh-cidr", "", "", "the cidr or ip address allowed to ssh in, defaults to your detected public ip")
+	awsBenchCmd.PersistentFlags().IntVarP(&benchEstimate,
+		"bench-estimate", "", 10, "a guess at the number of benchmarks the run has for the cost estimate, the benchmarks of a local directory are counted instead")
+	awsBenchCmd.PersistentFlags().BoolVarP(&overrideBudget,
+		"override-budget", "", false, "run even when the run would exceed the budget")
+	awsBenchCmd.PersistentFlags().StringVarP(&ref,
+		"ref", "", "", "the branch, tag, commit sha or pull request (#123 or pull/123) to benchmark, the default branch when empty")
+	awsBenchCmd.PersistentFlags().StringVarP(&base,
+		"base", "", "", "the revision to compare against on the same instance, the results end with a benchstat comparison of base and head")
+	awsBenchCmd.PersistentFlags().StringVarP(&head,
+		"head", "", "", "the revision compared against --base, the same as --ref")
+	awsBenchCmd.PersistentFlags().BoolVarP(&vendor,
+		"vendor", "", false, "include the vendor directory when benchmarking a local directory, even when it's ignored")
+	awsBenchCmd.PersistentFlags().BoolVarP(&forwardAgent,
+		"forward-agent", "", false, "clone a private repository with your ssh agent forwarded over corebench's ssh session")
+	awsBenchCmd.PersistentFlags().StringVarP(&gitTokenEnv,
+		"git-token-env", "", "", "the environment variable holding a short-lived token to clone a private repository over https with")
+	awsBenchCmd.PersistentFlags().StringVarP(&goPrivate,
+		"goprivate", "", "", "the GOPRIVATE pattern of private modules, the repository's owner by default")
+	awsBenchCmd.PersistentFlags().StringArrayVarP(&envMatrix,
+		"env-matrix", "", nil, "an environment variable and the values to benchmark with, NAME=value,value; repeat it for more variables, every combination is run")
+	awsBenchCmd.PersistentFlags().StringVarP(&setupScript,
+		"setup-script", "", "", "a script run as root once go is installed and before the source is fetched, to install cgo deps or tune the instance")
+	awsBenchCmd.PersistentFlags().StringSliceVarP(&aptPackages,
+		"apt-packages", "", nil, "extra apt packages installed before the setup script, comma delimited list")
+	awsBenchCmd.PersistentFlags().StringVarP(&preBench,
+		"pre-bench", "", "", "a shell command run in the package's directory before the benchmarks, they're skipped when it fails")
+	awsBenchCmd.PersistentFlags().StringVarP(&postBench,
+		"post-bench", "", "", "a shell command run in the package's directory after the benchmarks, even when they fail")
+	awsBenchCmd.PersistentFlags().BoolVarP(&dryRun,
+		"dry-run", "", false, "print what would be provisioned as json without creating anything")
 	awsBenchCmd.PersistentFlags().BoolVarP(&leaveRunning,
 		"leave-running", "", false, "indicates whether corebench should auto-terminate instance(s) on complete")
+	awsBenchCmd.PersistentFlags().DurationVarP(&maxLifetime,
+		"max-lifetime", "", 4*time.Hour, "the instance shuts itself down after this long even if corebench never tears it down, 0 disables it, defaults to 0 with --leave-running")
 	awsBenchCmd.PersistentFlags().BoolVarP(&stat,
 		"stat", "", false, "indicates whether corebench should generate benchstat summary")
 	awsBenchCmd.PersistentFlags().BoolVarP(&benchMem,
 		"benchmem", "", false, "indicates whether corebench include allocations just like the go tool")
 	awsBenchCmd.PersistentFlags().StringVarP(&goVersion,
-		"go", "", "1.10.1", "specifies the go version and must be a proper released version")
+		"go", "", "latest", "the go versions, comma delimited: latest, tip, a release such as 1.21 for its latest patch or an exact one such as 1.21.5")
 	awsCmd.AddCommand(awsBenchCmd)
 }
 
@@ -57,25 +130,63 @@ var awsBenchCmd = &cobra.Command{
 	Use:   "bench",
 	Short: "runs a remote benchmark on an aws instancetype",
 	Run: func(cmd *cobra.Command, args []string) {
-		ctx := context.Background()
+		ctx := signalContext()
 
 		if len(args) == 0 {
 			log.WithField("example_repo", "github.com/foo/bar").Fatal("You must specify a git repo to bench")
 		}
+		checkHeadFlag()
+		checkGoTestFlags()
+		checkMaxLifetime(cmd)
 
 		settings := &providers.AwsSpinSettings{
-			Git:              args[0],
-			InstanceType:     instanceType,
-			Benchmem:         benchMem,
-			RegexFlag:        regexString,
-			LeaveRunningFlag: leaveRunning,
-			GoVersionFlag:    goVersion,
-			CountFlag:        count,
-			StatFlag:         stat,
+			Git:                args[0],
+			InstanceType:       instanceType,
+			Cpu:                cpu,
+			BenchEstimateFlag:  benchEstimate,
+			Benchmem:           benchMem,
+			AptPackagesFlag:    aptPackageList(),
+			BaseFlag:           base,
+			RefFlag:            ref,
+			RegexFlag:          regexString,
+			BenchTimeFlag:      benchTime,
+			GcFlagsFlag:        gcFlags,
+			LdFlagsFlag:        ldFlags,
+			PackagesFlag:       packages,
+			RunFlag:            runRegex,
+			ShortFlag:          short,
+			TagsFlag:           tags,
+			TimeoutFlag:        testTimeout,
+			SSHCidrFlag:        sshCidr,
+			LeaveRunningFlag:   leaveRunning,
+			OverrideBudgetFlag: overrideBudget,
+			MaxLifetimeFlag:    maxLifetime,
+			GoVersionFlag:      goVersion,
+			CountFlag:          count,
+			DryRunFlag:         dryRun,
+			EnvMatrixFlag:      envMatrixDimensions(),
+			FileFlag:           awsfile,
+			ForwardAgentFlag:   forwardAgent,
+			GitTokenFlag:       gitToken(),
+			GoPrivateFlag:      goPrivate,
+			PostBenchFlag:      postBench,
+			PreBenchFlag:       preBench,
+			SetupScriptFlag:    setupScriptContents(),
+			StatFlag:           stat,
+			VendorFlag:         vendor,
+			Family:             benchFamily,
+			Zone:               awsZone,
+			Spot:               spot,
+			SpotMaxPrice:       spotMaxPrice,
+			SpotFallback:       spotFallback,
+			Direct:             direct,
+			Subnet:             subnet,
+			SecurityGroup:      secGroup,
 		}
 
-		provider := providers.NewAwsProvider()
-		provider.SetKeys(strings.Split(keypair, ","))
-		provider.Spinup(ctx, settings)
+		provider := providers.NewAwsProvider(awsRegion)
+		if err := provider.Spinup(ctx, settings); err != nil {
+			log.Fatal(err)
+		}
 	},
 }
@@ -40,7 +40,7 @@ var awsListCmd = &cobra.Command{
 	Use:   "list",
 	Short: "lists corebench resources provisioned in aws that are currently alive",
 	Run: func(cmd *cobra.Command, args []string) {
-		provider := providers.NewAwsProvider()
+		provider := providers.NewAwsProvider(awsRegion)
 		ctx := context.Background()
 		err := provider.List(ctx)
 		if err != nil {
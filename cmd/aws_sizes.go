@@ -22,28 +22,40 @@ SOFTWARE.
 package cmd
 
 import (
-	// "context"
-	// "log"
-	//
-	// "github.com/deckarep/corebench/pkg/providers"
-	// "github.com/spf13/cobra"
+	"context"
+	"log"
+
+	"github.com/deckarep/corebench/pkg/providers"
+	"github.com/spf13/cobra"
 )
 
-// TODO: implement displaying instance/resource types/stack costs, half this functionality exists with 'list' cmd already
+var (
+	awsFamily string
+	awsMinCpu int
+)
 
 func init() {
-	// awsCmd.AddCommand(awsSizesCmd)
+	awsSizesCmd.PersistentFlags().StringVarP(&awsFamily,
+		"family", "", "", "only show instance types of this family (e.g. c5)")
+	awsSizesCmd.PersistentFlags().IntVarP(&awsMinCpu,
+		"min-cpu", "", 0, "only show instance types with at least this many vcpus")
+	awsCmd.AddCommand(awsSizesCmd)
+}
+
+var awsSizesCmd = &cobra.Command{
+	Use:   "sizes",
+	Short: "sizes shows the aws instance types and their on-demand costs",
+	Run: func(cmd *cobra.Command, args []string) {
+		settings := &providers.AwsSizeSettings{
+			FamilyFlag: awsFamily,
+			MinCpuFlag: awsMinCpu,
+		}
+
+		provider := providers.NewAwsProvider(awsRegion)
+		ctx := context.Background()
+		err := provider.Sizes(ctx, settings)
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
 }
-//
-// var awsSizesCmd = &cobra.Command{
-// 	Use:   "sizes",
-// 	Short: "sizes shows the aws instance types and their associated costs",
-// 	Run: func(cmd *cobra.Command, args []string) {
-// 		provider := providers.NewAwsProvider("test")
-// 		ctx := context.Background()
-// 		err := provider.Sizes(ctx)
-// 		if err != nil {
-// 			log.Fatal(err)
-// 		}
-// 	},
-// }
@@ -30,11 +30,6 @@ import (
 	"github.com/spf13/cobra"
 )
 
-// TODO: clean up AwsTermSettings-related stuff, nlr
-
-func init() {
-}
-
 var (
 	awsall       bool
 	awsip        string
@@ -44,6 +39,10 @@ var (
 func init() {
 	awsTermCmd.PersistentFlags().BoolVarP(&awsall,
 		"all", "", false, "indicates if you would like to terminate all instances")
+	awsTermCmd.PersistentFlags().StringVarP(&instancename,
+		"name", "n", "", "terminate instance by name tag, or the cloudformation stack by its name")
+	awsTermCmd.PersistentFlags().StringVarP(&awsip,
+		"ip", "i", "", "terminate instance by ip address")
 	awsCmd.AddCommand(awsTermCmd)
 }
 
@@ -51,14 +50,22 @@ var awsTermCmd = &cobra.Command{
 	Use:   "term",
 	Short: "terminates corebench resources provisioned on aws that are currently alive",
 	Run: func(cmd *cobra.Command, args []string) {
+		if awsall && (awsip != "" || instancename != "") {
+			log.Fatal("You cannot choose --all and specify an --ip or --name at the same time.")
+		}
+
+		if awsip != "" && instancename != "" {
+			log.Fatal("You can only terminate instances by their --ip or --name but not both.")
+		}
 
+		// Without any criteria everything is terminated, which was the original behavior.
 		settings := &providers.AwsTermSettings{
-			AllFlag:  all,
-			IPFlag:   ip,
-			NameFlag: name,
+			AllFlag:  awsall || (awsip == "" && instancename == ""),
+			IPFlag:   awsip,
+			NameFlag: instancename,
 		}
 
-		provider := providers.NewAwsProvider()
+		provider := providers.NewAwsProvider(awsRegion)
 		ctx := context.Background()
 		err := provider.Term(ctx, settings)
 		if err != nil {
@@ -0,0 +1,116 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2018 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/deckarep/corebench/pkg/providers"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// benchIterations matches a -benchtime given as a number of iterations.
+var benchIterations = regexp.MustCompile(`^[0-9]+x$`)
+
+// aptPackageName matches a package name, optionally with its architecture or version pinned.
+var aptPackageName = regexp.MustCompile(`^[a-z0-9][a-z0-9+.-]*(:[a-z0-9]+)?(=[A-Za-z0-9.+~:-]+)?$`)
+
+// checkHeadFlag folds --head into --ref, they both name the revision to benchmark.
+func checkHeadFlag() {
+	if head == "" {
+		return
+	}
+	if ref != "" && ref != head {
+		log.Fatal("--head and --ref both name the revision to benchmark, only give one of them")
+	}
+	ref = head
+}
+
+// checkMaxLifetime keeps an instance left running with --leave-running up unless --max-lifetime is given too.
+func checkMaxLifetime(cmd *cobra.Command) {
+	if leaveRunning && !cmd.Flags().Changed("max-lifetime") {
+		maxLifetime = 0
+	}
+}
+
+// checkGoTestFlags fails on the go test flags that go test would only reject once an instance is billing.
+func checkGoTestFlags() {
+	if benchTime != "" && !benchIterations.MatchString(benchTime) {
+		if _, err := time.ParseDuration(benchTime); err != nil {
+			log.Fatalf("--benchtime %q is neither a duration such as 2s nor a number of iterations such as 100x", benchTime)
+		}
+	}
+	for _, pattern := range packages {
+		if strings.HasPrefix(pattern, "-") {
+			log.Fatalf("--packages %q is a flag, not a package pattern", pattern)
+		}
+	}
+}
+
+// gitToken reads the token named by --git-token-env, it's taken from the environment so it never shows up in
+// the process list or the shell history.
+func gitToken() string {
+	if gitTokenEnv == "" {
+		return ""
+	}
+	token := os.Getenv(gitTokenEnv)
+	if token == "" {
+		log.Fatalf("--git-token-env names %s but it isn't set", gitTokenEnv)
+	}
+	return token
+}
+
+// setupScriptContents reads the --setup-script, it's embedded in the bootstrap so it must be on this machine.
+func setupScriptContents() string {
+	if setupScript == "" {
+		return ""
+	}
+	contents, err := ioutil.ReadFile(setupScript)
+	if err != nil {
+		log.Fatalf("failed to read the setup script: %s", err)
+	}
+	return string(contents)
+}
+
+// envMatrixDimensions parses the --env-matrix specs.
+func envMatrixDimensions() []providers.EnvDimension {
+	dims, err := providers.ParseEnvMatrix(envMatrix)
+	if err != nil {
+		log.Fatalf("--env-matrix: %s", err)
+	}
+	return dims
+}
+
+// aptPackageList checks the --apt-packages are package names before they're installed.
+func aptPackageList() []string {
+	for _, name := range aptPackages {
+		if !aptPackageName.MatchString(name) {
+			log.Fatalf("%q is not an apt package name", name)
+		}
+	}
+	return aptPackages
+}
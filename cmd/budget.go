@@ -0,0 +1,93 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2018 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/deckarep/corebench/pkg/budget"
+	"github.com/spf13/cobra"
+)
+
+var (
+	budgetMaxHourly float64
+	budgetMaxRun    float64
+	budgetMonthly   float64
+)
+
+func init() {
+	budgetCmd.PersistentFlags().Float64VarP(&budgetMaxHourly,
+		"max-hourly", "", 0, "the max hourly rate of an instance in $, 0 is unlimited")
+	budgetCmd.PersistentFlags().Float64VarP(&budgetMaxRun,
+		"max-run", "", 0, "the max estimated cost of a single run in $, 0 is unlimited")
+	budgetCmd.PersistentFlags().Float64VarP(&budgetMonthly,
+		"monthly", "", 0, "the max spend per calendar month in $, 0 is unlimited")
+	RootCmd.AddCommand(budgetCmd)
+}
+
+// budgetCmd shows the budget and this month's spend, and updates the limits given as flags.
+var budgetCmd = &cobra.Command{
+	Use:   "budget",
+	Short: "shows or sets the spending budget bench runs are checked against",
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := budget.Load()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		flags := cmd.Flags()
+		if flags.Changed("max-hourly") || flags.Changed("max-run") || flags.Changed("monthly") {
+			if flags.Changed("max-hourly") {
+				config.MaxHourlyRate = budgetMaxHourly
+			}
+			if flags.Changed("max-run") {
+				config.MaxRunCost = budgetMaxRun
+			}
+			if flags.Changed("monthly") {
+				config.MonthlyCap = budgetMonthly
+			}
+			if err := config.Save(); err != nil {
+				log.Fatal(err)
+			}
+			log.Info("Budget updated")
+		}
+
+		spent, err := budget.MonthToDate(time.Now())
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		limit := func(v float64) string {
+			if v == 0 {
+				return "unlimited"
+			}
+			return fmt.Sprintf("$%.2f", v)
+		}
+		fmt.Println("Max hourly rate:  ", limit(config.MaxHourlyRate))
+		fmt.Println("Max cost per run: ", limit(config.MaxRunCost))
+		fmt.Println("Monthly cap:      ", limit(config.MonthlyCap))
+		fmt.Printf("Spent this month:  $%.2f\n", spent)
+	},
+}
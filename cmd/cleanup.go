@@ -0,0 +1,121 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2018 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/deckarep/corebench/pkg/ledger"
+	"github.com/deckarep/corebench/pkg/providers"
+	"github.com/deckarep/corebench/pkg/utility"
+	"github.com/spf13/cobra"
+)
+
+var (
+	cleanupAll   bool
+	cleanupToken string
+)
+
+func init() {
+	cleanupCmd.PersistentFlags().BoolVarP(&cleanupAll,
+		"all", "", false, "also tear down runs that were left running with --leave-running")
+	cleanupCmd.PersistentFlags().StringVarP(&cleanupToken,
+		"DO_PAT", "", "", "digitalocean personal access token, needed to clean up digitalocean runs")
+	RootCmd.AddCommand(cleanupCmd)
+}
+
+// cleanupCmd tears down whatever is left in the ledger, typically after corebench was killed mid run.
+var cleanupCmd = &cobra.Command{
+	Use:   "cleanup",
+	Short: "tears down resources left behind by corebench runs that didn't finish",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+
+		book, err := ledger.Open()
+		if err != nil {
+			log.Fatal(err)
+		}
+		runs, err := book.Runs()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var pending []ledger.Run
+		for _, run := range runs {
+			if run.Kept && !cleanupAll {
+				log.Infof("Skipping %s which was left running, use --all to tear it down", run.ID)
+				continue
+			}
+			pending = append(pending, run)
+		}
+		if len(pending) == 0 {
+			log.Info("Nothing to clean up")
+			return
+		}
+
+		for _, run := range pending {
+			fmt.Printf("%s\t%s\t%s\t%d resources\n", run.Provider, run.ID, run.Created.Local().Format("2006-01-02 15:04"), len(run.Resources))
+		}
+		if !utility.PromptConfirmation("Tear down these runs? (Yy)es/(Nn)o") {
+			log.Info("Quitting")
+			return
+		}
+
+		failed := 0
+		for _, run := range pending {
+			var provider providers.Provider
+			switch run.Provider {
+			case "aws":
+				provider = providers.NewAwsProvider(run.Region)
+			case "digitalocean":
+				if cleanupToken == "" {
+					log.WithField("run", run.ID).Warning("Skipping digitalocean run, --DO_PAT is required")
+					failed++
+					continue
+				}
+				provider = providers.NewDigitalOceanProvider(cleanupToken)
+			default:
+				log.WithField("run", run.ID).Warningf("Skipping run of unknown provider %q", run.Provider)
+				failed++
+				continue
+			}
+
+			log.Infof("Cleaning up %s...", run.ID)
+			if err := provider.Cleanup(ctx, run); err != nil {
+				log.WithField("run", run.ID).Error(err)
+				failed++
+				continue
+			}
+			if err := book.Forget(run.ID); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		if failed > 0 {
+			log.Fatalf("(%d) runs could not be cleaned up, rerun corebench cleanup to retry", failed)
+		}
+		log.Infof("Cleaned up (%d) runs", len(pending))
+	},
+}
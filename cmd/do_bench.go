@@ -22,9 +22,9 @@ SOFTWARE.
 package cmd
 
 import (
-	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/deckarep/corebench/pkg/providers"
 	log "github.com/sirupsen/logrus"
@@ -32,14 +32,39 @@ import (
 )
 
 var (
-	keys         string
-	cpu          string
-	leaveRunning bool
-	benchMem     bool
-	regexString  string
-	goVersion    string
-	count        int
-	stat         bool
+	keys           string
+	cpu            string
+	leaveRunning   bool
+	dryRun         bool
+	overrideBudget bool
+	maxLifetime    time.Duration
+	benchMem       bool
+	benchEstimate  int
+	regexString    string
+	ref            string
+	base           string
+	head           string
+	sshCidr        string
+	goVersion      string
+	count          int
+	stat           bool
+	vendor         bool
+	forwardAgent   bool
+	gitTokenEnv    string
+	goPrivate      string
+	setupScript    string
+	preBench       string
+	postBench      string
+	aptPackages    []string
+	envMatrix      []string
+	packages       []string
+	benchTime      string
+	testTimeout    time.Duration
+	tags           []string
+	runRegex       string
+	short          bool
+	gcFlags        string
+	ldFlags        string
 )
 
 // Usage: ./corebench do bench -t=$TOKEN -k=$SSH_FINGERPRINT -git github.com/deckarep/golang-set
@@ -47,17 +72,67 @@ func init() {
 	digitalOceanBenchCmd.PersistentFlags().StringVarP(&keys,
 		"ssh-fp", "", "", "ssh fingerprints allow you to embed ssh keys via their MD5 fingerprint id, comma delimited list")
 	digitalOceanBenchCmd.PersistentFlags().StringVarP(&cpu,
-		"cpu", "c", "`nproc`", "cpu is a comma delimited list: -cpu=1,2,4,8 or -cpu=1-16")
+		"cpu", "c", "", "every cpu of the instance by default, or a comma delimited list: -cpu=1,2,4,8")
 	digitalOceanBenchCmd.PersistentFlags().StringVarP(&regexString,
 		"regex", "", "", "a regex to filter bench tests by")
+	digitalOceanBenchCmd.PersistentFlags().StringSliceVarP(&packages,
+		"packages", "", nil, "the package patterns to benchmark relative to the package given, such as ./... or ./sub, comma delimited list")
+	digitalOceanBenchCmd.PersistentFlags().StringVarP(&benchTime,
+		"benchtime", "", "", "go test's -benchtime, how long each benchmark runs (2s) or how many iterations (100x)")
+	digitalOceanBenchCmd.PersistentFlags().DurationVarP(&testTimeout,
+		"timeout", "", 0, "go test's -timeout, go test's default of 10m when 0")
+	digitalOceanBenchCmd.PersistentFlags().StringSliceVarP(&tags,
+		"tags", "", nil, "the build tags to benchmark with, comma delimited list")
+	digitalOceanBenchCmd.PersistentFlags().StringVarP(&runRegex,
+		"run", "", "^$", "go test's -run, the tests are skipped by default and an empty value runs them all")
+	digitalOceanBenchCmd.PersistentFlags().BoolVarP(&short,
+		"short", "", false, "go test's -short")
+	digitalOceanBenchCmd.PersistentFlags().StringVarP(&gcFlags,
+		"gcflags", "", "", "go test's -gcflags")
+	digitalOceanBenchCmd.PersistentFlags().StringVarP(&ldFlags,
+		"ldflags", "", "", "go test's -ldflags")
+	digitalOceanBenchCmd.PersistentFlags().StringVarP(&sshCidr,
+		"ssh-cidr", "", "", "the cidr or ip address allowed to ssh in, defaults to your detected public ip")
+	digitalOceanBenchCmd.PersistentFlags().IntVarP(&benchEstimate,
+		"bench-estimate", "", 10, "a guess at the number of benchmarks the run has for the cost estimate, the benchmarks of a local directory are counted instead")
+	digitalOceanBenchCmd.PersistentFlags().BoolVarP(&overrideBudget,
+		"override-budget", "", false, "run even when the run would exceed the budget")
+	digitalOceanBenchCmd.PersistentFlags().StringVarP(&ref,
+		"ref", "", "", "the branch, tag, commit sha or pull request (#123 or pull/123) to benchmark, the default branch when empty")
+	digitalOceanBenchCmd.PersistentFlags().StringVarP(&base,
+		"base", "", "", "the revision to compare against on the same instance, the results end with a benchstat comparison of base and head")
+	digitalOceanBenchCmd.PersistentFlags().StringVarP(&head,
+		"head", "", "", "the revision compared against --base, the same as --ref")
+	digitalOceanBenchCmd.PersistentFlags().BoolVarP(&vendor,
+		"vendor", "", false, "include the vendor directory when benchmarking a local directory, even when it's ignored")
+	digitalOceanBenchCmd.PersistentFlags().BoolVarP(&forwardAgent,
+		"forward-agent", "", false, "clone a private repository with your ssh agent forwarded over corebench's ssh session")
+	digitalOceanBenchCmd.PersistentFlags().StringVarP(&gitTokenEnv,
+		"git-token-env", "", "", "the environment variable holding a short-lived token to clone a private repository over https with")
+	digitalOceanBenchCmd.PersistentFlags().StringVarP(&goPrivate,
+		"goprivate", "", "", "the GOPRIVATE pattern of private modules, the repository's owner by default")
+	digitalOceanBenchCmd.PersistentFlags().StringArrayVarP(&envMatrix,
+		"env-matrix", "", nil, "an environment variable and the values to benchmark with, NAME=value,value; repeat it for more variables, every combination is run")
+	digitalOceanBenchCmd.PersistentFlags().StringVarP(&setupScript,
+		"setup-script", "", "", "a script run as root once go is installed and before the source is fetched, to install cgo deps or tune the instance")
+	digitalOceanBenchCmd.PersistentFlags().StringSliceVarP(&aptPackages,
+		"apt-packages", "", nil, "extra apt packages installed before the setup script, comma delimited list")
+	digitalOceanBenchCmd.PersistentFlags().StringVarP(&preBench,
+		"pre-bench", "", "", "a shell command run in the package's directory before the benchmarks, they're skipped when it fails")
+	digitalOceanBenchCmd.PersistentFlags().StringVarP(&postBench,
+		"post-bench", "", "", "a shell command run in the package's directory after the benchmarks, even when they fail")
+	digitalOceanBenchCmd.PersistentFlags().BoolVarP(&dryRun,
+		"dry-run", "", false, "print what would be provisioned as json without creating anything")
 	digitalOceanBenchCmd.PersistentFlags().BoolVarP(&leaveRunning,
 		"leave-running", "", false, "indicates whether corebench should auto-terminate instance(s) on complete")
+	digitalOceanBenchCmd.PersistentFlags().DurationVarP(&maxLifetime,
+		"max-lifetime", "", 4*time.Hour, "the instance shuts itself down after this long even if corebench never tears it down, 0 disables it, defaults to 0 with --leave-running")
 	digitalOceanBenchCmd.PersistentFlags().BoolVarP(&stat,
 		"stat", "", false, "indicates whether corebench should generate benchstat summary")
 	digitalOceanBenchCmd.PersistentFlags().BoolVarP(&benchMem,
 		"benchmem", "", false, "indicates whether corebench include allocations just like the go tool")
 	digitalOceanBenchCmd.PersistentFlags().StringVarP(&goVersion,
-		"go", "", "1.10.1", "specifies the go version and must be a proper released version")
+		"go", "", "latest", "the go versions, comma delimited: latest, tip, a release such as 1.21 for its latest patch or an exact one such as 1.21.5")
 	digitalOceanBenchCmd.PersistentFlags().IntVarP(&count,
 		"count", "", 1, "specifes the number of iterations to run the benchmark")
 
@@ -70,21 +145,49 @@ var digitalOceanBenchCmd = &cobra.Command{
 	Use:   "bench",
 	Short: "runs a remote benchmark on a multi-core cloud resource from digitalocean",
 	Run: func(cmd *cobra.Command, args []string) {
-		ctx := context.Background()
+		ctx := signalContext()
 
 		if len(args) == 0 {
 			log.WithField("example_repo", "github.com/foo/bar").Fatal("You must specify a git repo to bench")
 		}
+		checkHeadFlag()
+		checkGoTestFlags()
+		checkMaxLifetime(cmd)
 
 		settings := &providers.DoSpinSettings{
-			Git:              args[0],
-			Cpu:              cpu,
-			Benchmem:         benchMem,
-			RegexFlag:        regexString,
-			LeaveRunningFlag: leaveRunning,
-			GoVersionFlag:    goVersion,
-			CountFlag:        count,
-			StatFlag:         stat,
+			Git:                args[0],
+			Cpu:                cpu,
+			BenchEstimateFlag:  benchEstimate,
+			Benchmem:           benchMem,
+			AptPackagesFlag:    aptPackageList(),
+			BaseFlag:           base,
+			RefFlag:            ref,
+			RegexFlag:          regexString,
+			BenchTimeFlag:      benchTime,
+			GcFlagsFlag:        gcFlags,
+			LdFlagsFlag:        ldFlags,
+			PackagesFlag:       packages,
+			RunFlag:            runRegex,
+			ShortFlag:          short,
+			TagsFlag:           tags,
+			TimeoutFlag:        testTimeout,
+			SSHCidrFlag:        sshCidr,
+			LeaveRunningFlag:   leaveRunning,
+			OverrideBudgetFlag: overrideBudget,
+			MaxLifetimeFlag:    maxLifetime,
+			GoVersionFlag:      goVersion,
+			CountFlag:          count,
+			DryRunFlag:         dryRun,
+			EnvMatrixFlag:      envMatrixDimensions(),
+			FileFlag:           file,
+			ForwardAgentFlag:   forwardAgent,
+			GitTokenFlag:       gitToken(),
+			GoPrivateFlag:      goPrivate,
+			PostBenchFlag:      postBench,
+			PreBenchFlag:       preBench,
+			SetupScriptFlag:    setupScriptContents(),
+			StatFlag:           stat,
+			VendorFlag:         vendor,
 		}
 
 		provider := providers.NewDigitalOceanProvider(token)
@@ -94,6 +197,8 @@ var digitalOceanBenchCmd = &cobra.Command{
 		}
 
 		fmt.Println()
-		provider.Spinup(ctx, settings)
+		if err := provider.Spinup(ctx, settings); err != nil {
+			log.Fatal(err)
+		}
 	},
 }
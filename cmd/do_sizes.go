@@ -29,7 +29,13 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var (
+	minCpu int
+)
+
 func init() {
+	digitalOceanSizesCmd.PersistentFlags().IntVarP(&minCpu,
+		"min-cpu", "", 0, "only show droplet sizes with at least this many vcpus")
 	digitalOceanCmd.AddCommand(digitalOceanSizesCmd)
 }
 
@@ -37,9 +43,13 @@ var digitalOceanSizesCmd = &cobra.Command{
 	Use:   "sizes",
 	Short: "sizes shows the digital ocean slug sizes and their costs",
 	Run: func(cmd *cobra.Command, args []string) {
+		settings := &providers.DoSizeSettings{
+			MinCpuFlag: minCpu,
+		}
+
 		provider := providers.NewDigitalOceanProvider(token)
 		ctx := context.Background()
-		err := provider.Sizes(ctx)
+		err := provider.Sizes(ctx, settings)
 		if err != nil {
 			log.Fatal(err)
 		}
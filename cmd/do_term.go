@@ -31,9 +31,10 @@ import (
 )
 
 var (
-	all  bool
-	ip   string
-	name string
+	all     bool
+	expired bool
+	ip      string
+	name    string
 )
 
 func init() {
@@ -43,6 +44,8 @@ func init() {
 		"name", "n", "", "terminate instance by droplet name")
 	digitalOceanTermCmd.PersistentFlags().StringVarP(&ip,
 		"ip", "i", "", "terminate instance by ip address")
+	digitalOceanTermCmd.PersistentFlags().BoolVarP(&expired,
+		"expired", "", false, "terminate instances that have outlived their --max-lifetime")
 
 	digitalOceanCmd.AddCommand(digitalOceanTermCmd)
 }
@@ -53,22 +56,27 @@ var digitalOceanTermCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		ctx := context.Background()
 
-		if ip == "" && name == "" && !all {
-			log.Fatal("You must choose an option to terminate instances: either --all, --ip, or --name")
+		if ip == "" && name == "" && !all && !expired {
+			log.Fatal("You must choose an option to terminate instances: either --all, --expired, --ip, or --name")
 		}
 
 		if all && (ip != "" || name != "") {
 			log.Fatal("You cannot choose --all and specify an --ip or --name at the same time.")
 		}
 
+		if expired && (all || ip != "" || name != "") {
+			log.Fatal("You cannot choose --expired along with --all, --ip or --name.")
+		}
+
 		if ip != "" && name != "" {
 			log.Fatal("You can only terminate instances by their --ip or --name but not both.")
 		}
 
 		settings := &providers.DoTermSettings{
-			AllFlag:  all,
-			IPFlag:   ip,
-			NameFlag: name,
+			AllFlag:     all,
+			ExpiredFlag: expired,
+			IPFlag:      ip,
+			NameFlag:    name,
 		}
 
 		provider := providers.NewDigitalOceanProvider(token)
@@ -0,0 +1,145 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2018 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/deckarep/corebench/pkg/ledger"
+	"github.com/deckarep/corebench/pkg/providers"
+	"github.com/deckarep/corebench/pkg/utility"
+	"github.com/spf13/cobra"
+)
+
+var (
+	gcOlderThan time.Duration
+	gcToken     string
+	gcRegions   []string
+)
+
+func init() {
+	gcCmd.PersistentFlags().DurationVarP(&gcOlderThan,
+		"older-than", "", 24*time.Hour, "flag resources older than this even when their run is in the ledger")
+	gcCmd.PersistentFlags().StringVarP(&gcToken,
+		"DO_PAT", "", "", "digitalocean personal access token, digitalocean is skipped without it")
+	gcCmd.PersistentFlags().StringSliceVarP(&gcRegions,
+		"region", "", []string{"us-east-1"}, "the aws regions to search, aws is skipped when no credentials are configured")
+	RootCmd.AddCommand(gcCmd)
+}
+
+// orphan is a resource gc flagged for deletion.
+type orphan struct {
+	provider providers.Provider
+	resource providers.Resource
+	reason   string
+}
+
+// gcCmd finds corebench resources that outlived their run on every configured provider, it's safe to run from cron with --yes.
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "finds and deletes corebench resources that outlived their run across all providers",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+
+		book, err := ledger.Open()
+		if err != nil {
+			log.Fatal(err)
+		}
+		runs, err := book.Runs()
+		if err != nil {
+			log.Fatal(err)
+		}
+		known := make(map[string]bool)
+		for _, run := range runs {
+			known[run.ID] = true
+		}
+
+		var configured []providers.Provider
+		if gcToken != "" {
+			configured = append(configured, providers.NewDigitalOceanProvider(gcToken))
+		} else {
+			log.Info("Skipping digitalocean, no --DO_PAT given")
+		}
+		if providers.AwsConfigured() {
+			for _, region := range gcRegions {
+				configured = append(configured, providers.NewAwsProvider(region))
+			}
+		} else {
+			log.Info("Skipping aws, no credentials are configured")
+		}
+
+		failed := 0
+		now := time.Now()
+		var orphans []orphan
+		for _, provider := range configured {
+			resources, err := provider.Resources(ctx)
+			if err != nil {
+				log.Error("Failed to list resources: ", err)
+				failed++
+				continue
+			}
+			for _, r := range resources {
+				switch {
+				case !known[r.RunID]:
+					orphans = append(orphans, orphan{provider, r, "not in ledger"})
+				case !r.Created.IsZero() && now.Sub(r.Created) > gcOlderThan:
+					orphans = append(orphans, orphan{provider, r, "older than " + gcOlderThan.String()})
+				}
+			}
+		}
+
+		if len(orphans) == 0 {
+			log.Info("No orphaned resources found")
+		} else {
+			w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+			fmt.Fprintln(w, "Provider\tKind\tName\tID\tAge\tReason\t")
+			for _, o := range orphans {
+				age := "unknown"
+				if !o.resource.Created.IsZero() {
+					age = now.Sub(o.resource.Created).Round(time.Minute).String()
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t\n", o.resource.Provider, o.resource.Kind, o.resource.Name, o.resource.ID, age, o.reason)
+			}
+			w.Flush()
+
+			if utility.PromptConfirmation("Delete these resources? (Yy)es/(Nn)o") {
+				for _, o := range orphans {
+					log.Infof("Deleting %s %s...", o.resource.Kind, o.resource.Name)
+					if err := o.provider.DeleteResource(ctx, o.resource); err != nil {
+						log.WithField("id", o.resource.ID).Error("Failed to delete: ", err)
+						failed++
+					}
+				}
+			}
+		}
+
+		if failed > 0 {
+			log.Fatalf("(%d) providers or resources failed, they need to be retried or deleted manually", failed)
+		}
+	},
+}
@@ -22,11 +22,44 @@ SOFTWARE.
 package cmd
 
 import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/deckarep/corebench/pkg/utility"
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
+var assumeYes bool
+
+func init() {
+	RootCmd.PersistentFlags().BoolVarP(&assumeYes,
+		"yes", "y", false, "answer yes to every prompt so corebench can run non-interactively")
+}
+
 // RootCmd is the entry point into the corebench tool.
 var RootCmd = &cobra.Command{
 	Use:   "corebench",
 	Short: "corebench: a benchmarking tool",
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		utility.AssumeYes = assumeYes
+	},
+}
+
+// signalContext returns a context that's cancelled on SIGINT or SIGTERM so provisioned resources are torn
+// down before exiting, a second signal exits right away.
+func signalContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		log.Warn("Interrupted, tearing down resources... (interrupt again to exit right away)")
+		cancel()
+		<-sigs
+		log.Fatal("Exiting before teardown finished, run \"corebench cleanup\" to remove what's left")
+	}()
+	return ctx
 }
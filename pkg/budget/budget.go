@@ -0,0 +1,176 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2018 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+// Package budget keeps corebench's spending in check: a budget configured per user and the history
+// of what past runs have cost.
+package budget
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/deckarep/corebench/pkg/utility"
+)
+
+const (
+	configFile  = "budget.json"
+	historyFile = "history.json"
+	// lockFile is locked around every change to the history, several corebench runs can finish at once.
+	lockFile = "history.lock"
+)
+
+// Config is the spending budget, a zero limit is unlimited.
+type Config struct {
+	MaxHourlyRate float64 `json:"max_hourly_rate"`
+	MaxRunCost    float64 `json:"max_run_cost"`
+	MonthlyCap    float64 `json:"monthly_cap"`
+}
+
+// Spend is what a single run cost.
+type Spend struct {
+	ID           string        `json:"id"`
+	Provider     string        `json:"provider"`
+	InstanceType string        `json:"instance_type"`
+	Started      time.Time     `json:"started"`
+	Billable     time.Duration `json:"billable"`
+	Cost         float64       `json:"cost"`
+	// LeftRunning is set when the instance was left running, it's only billable until corebench exited.
+	LeftRunning bool `json:"left_running,omitempty"`
+}
+
+// Load returns the budget, when none is configured everything is unlimited.
+func Load() (*Config, error) {
+	var c Config
+	if err := readFile(configFile, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Save persists the budget.
+func (c *Config) Save() error {
+	return writeFile(configFile, c)
+}
+
+// Limited reports whether any limit is configured.
+func (c *Config) Limited() bool {
+	return c.MaxHourlyRate > 0 || c.MaxRunCost > 0 || c.MonthlyCap > 0
+}
+
+// Violations returns every way a run at the hourly rate and estimated cost would exceed the budget given
+// what has already been spent this month.
+func (c *Config) Violations(hourly, estimate, monthToDate float64) []string {
+	if !c.Limited() {
+		return nil
+	}
+	if hourly == 0 {
+		return []string{"the hourly price is unavailable so the budget can't be enforced"}
+	}
+
+	var violations []string
+	if c.MaxHourlyRate > 0 && hourly > c.MaxHourlyRate {
+		violations = append(violations, fmt.Sprintf("hourly rate $%.4f exceeds the max of $%.4f", hourly, c.MaxHourlyRate))
+	}
+	if c.MaxRunCost > 0 && estimate > c.MaxRunCost {
+		violations = append(violations, fmt.Sprintf("estimated cost $%.2f exceeds the max of $%.2f per run", estimate, c.MaxRunCost))
+	}
+	if c.MonthlyCap > 0 && monthToDate+estimate > c.MonthlyCap {
+		violations = append(violations, fmt.Sprintf("estimated cost $%.2f on top of $%.2f spent this month exceeds the monthly cap of $%.2f", estimate, monthToDate, c.MonthlyCap))
+	}
+	return violations
+}
+
+// Record appends a run's spend to the history.
+func Record(s Spend) (err error) {
+	dir, err := utility.ConfigDir()
+	if err != nil {
+		return err
+	}
+	unlock, err := utility.LockFile(filepath.Join(dir, lockFile))
+	if err != nil {
+		return fmt.Errorf("failed to lock the history: %s", err)
+	}
+	defer func() {
+		if unlockErr := unlock(); err == nil {
+			err = unlockErr
+		}
+	}()
+
+	var history []Spend
+	if err := readFile(historyFile, &history); err != nil {
+		return err
+	}
+	return writeFile(historyFile, append(history, s))
+}
+
+// MonthToDate returns the total spend of the runs started in the same month as now.
+func MonthToDate(now time.Time) (float64, error) {
+	var history []Spend
+	if err := readFile(historyFile, &history); err != nil {
+		return 0, err
+	}
+
+	year, month, _ := now.Date()
+	var total float64
+	for _, s := range history {
+		if y, m, _ := s.Started.In(now.Location()).Date(); y == year && m == month {
+			total += s.Cost
+		}
+	}
+	return total, nil
+}
+
+func readFile(name string, v interface{}) error {
+	dir, err := utility.ConfigDir()
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// writeFile replaces the file through a rename so it's never left half written.
+func writeFile(name string, v interface{}) error {
+	dir, err := utility.ConfigDir()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path+".tmp", data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
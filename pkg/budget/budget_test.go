@@ -0,0 +1,201 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2018 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package budget
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testHome points the config directory at an empty temporary home.
+func testHome(t *testing.T) {
+	home, err := ioutil.TempDir("", "corebench-budget")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(home) })
+	t.Setenv("HOME", home)
+}
+
+func TestViolations(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      Config
+		hourly      float64
+		estimate    float64
+		monthToDate float64
+		want        []string
+	}{
+		{"unlimited", Config{}, 10, 100, 1000, nil},
+		{"unlimited without a price", Config{}, 0, 0, 0, nil},
+		{"no price to enforce against", Config{MaxRunCost: 1}, 0, 0, 0, []string{"hourly price is unavailable"}},
+		{"hourly rate under", Config{MaxHourlyRate: 1}, 0.5, 1, 0, nil},
+		{"hourly rate at the max", Config{MaxHourlyRate: 1}, 1, 1, 0, nil},
+		{"hourly rate over", Config{MaxHourlyRate: 1}, 1.5, 1, 0, []string{"hourly rate $1.5000 exceeds the max of $1.0000"}},
+		{"run cost under", Config{MaxRunCost: 5}, 1, 4.99, 0, nil},
+		{"run cost over", Config{MaxRunCost: 5}, 1, 5.01, 0, []string{"estimated cost $5.01 exceeds the max of $5.00 per run"}},
+		{"monthly cap under", Config{MonthlyCap: 50}, 1, 5, 44, nil},
+		{"monthly cap reached exactly", Config{MonthlyCap: 50}, 1, 5, 45, nil},
+		{"monthly cap over", Config{MonthlyCap: 50}, 1, 5, 46, []string{"on top of $46.00 spent this month exceeds the monthly cap of $50.00"}},
+		{
+			"every limit over",
+			Config{MaxHourlyRate: 1, MaxRunCost: 5, MonthlyCap: 50},
+			2, 10, 45,
+			[]string{"hourly rate", "per run", "monthly cap"},
+		},
+	}
+	for _, tt := range tests {
+		got := tt.config.Violations(tt.hourly, tt.estimate, tt.monthToDate)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: Violations() = %q, want %d violations", tt.name, got, len(tt.want))
+			continue
+		}
+		for i := range got {
+			if !strings.Contains(got[i], tt.want[i]) {
+				t.Errorf("%s: violation %q, want one containing %q", tt.name, got[i], tt.want[i])
+			}
+		}
+	}
+}
+
+func TestMonthToDateMissingHistory(t *testing.T) {
+	testHome(t)
+
+	spent, err := MonthToDate(time.Now())
+	if err != nil || spent != 0 {
+		t.Errorf("MonthToDate() without a history = %v, %v, want 0 and no error", spent, err)
+	}
+}
+
+func TestMonthToDate(t *testing.T) {
+	testHome(t)
+
+	history := []Spend{
+		{ID: "last-month", Started: time.Date(2026, 9, 30, 23, 59, 59, 0, time.UTC), Cost: 1},
+		{ID: "first-second", Started: time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), Cost: 2},
+		{ID: "mid-month", Started: time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC), Cost: 4},
+		{ID: "last-second", Started: time.Date(2026, 10, 31, 23, 59, 59, 0, time.UTC), Cost: 8},
+		{ID: "next-month", Started: time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC), Cost: 16},
+		{ID: "last-year", Started: time.Date(2025, 10, 15, 12, 0, 0, 0, time.UTC), Cost: 32},
+	}
+	for _, s := range history {
+		if err := Record(s); err != nil {
+			t.Fatalf("Record(%s) failed: %s", s.ID, err)
+		}
+	}
+
+	// Months are taken in the location of now, UTC+2 moves the first and last seconds of October UTC.
+	plus2 := time.FixedZone("UTC+2", 2*60*60)
+	tests := []struct {
+		name string
+		now  time.Time
+		want float64
+	}{
+		{"start of the month", time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), 14},
+		{"end of the month", time.Date(2026, 10, 31, 23, 59, 59, 0, time.UTC), 14},
+		{"next month", time.Date(2026, 11, 2, 0, 0, 0, 0, time.UTC), 16},
+		{"a month with nothing", time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC), 0},
+		{"same month last year", time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC), 32},
+		{"october in UTC+2", time.Date(2026, 10, 15, 0, 0, 0, 0, plus2), 1 + 2 + 4},
+		{"november in UTC+2", time.Date(2026, 11, 15, 0, 0, 0, 0, plus2), 8 + 16},
+	}
+	for _, tt := range tests {
+		spent, err := MonthToDate(tt.now)
+		if err != nil {
+			t.Fatalf("%s: MonthToDate() failed: %s", tt.name, err)
+		}
+		if spent != tt.want {
+			t.Errorf("%s: MonthToDate() = %v, want %v", tt.name, spent, tt.want)
+		}
+	}
+}
+
+// TestRecordAcrossProcesses records from several processes at once, like corebench runs finishing side by
+// side, none of the spend may be lost or the monthly cap would under count.
+func TestRecordAcrossProcesses(t *testing.T) {
+	const processes, records = 4, 25
+	testHome(t)
+
+	var cmds []*exec.Cmd
+	for p := 0; p < processes; p++ {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestBudgetHelperProcess$")
+		cmd.Env = append(os.Environ(), fmt.Sprintf("COREBENCH_BUDGET_HELPER=p%d", p))
+		cmd.Stderr = os.Stderr
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		cmds = append(cmds, cmd)
+	}
+	for _, cmd := range cmds {
+		if err := cmd.Wait(); err != nil {
+			t.Fatalf("helper process failed: %s", err)
+		}
+	}
+
+	var history []Spend
+	if err := readFile(historyFile, &history); err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != processes*records {
+		t.Errorf("%d runs recorded, want %d", len(history), processes*records)
+	}
+	spent, err := MonthToDate(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := float64(processes * records); spent != want {
+		t.Errorf("got $%.2f spent this month, want $%.2f", spent, want)
+	}
+}
+
+// TestBudgetHelperProcess isn't a test, it's the process TestRecordAcrossProcesses starts.
+func TestBudgetHelperProcess(t *testing.T) {
+	id := os.Getenv("COREBENCH_BUDGET_HELPER")
+	if id == "" {
+		return
+	}
+	for i := 0; i < 25; i++ {
+		err := Record(Spend{ID: fmt.Sprintf("%s-%d", id, i), Provider: "aws", Started: time.Now().UTC(), Cost: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRecordLeftRunning(t *testing.T) {
+	testHome(t)
+	if err := Record(Spend{ID: "kept", Started: time.Now().UTC(), Cost: 0.5, LeftRunning: true}); err != nil {
+		t.Fatal(err)
+	}
+	var history []Spend
+	if err := readFile(historyFile, &history); err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || !history[0].LeftRunning {
+		t.Errorf("got %+v, want the run marked as left running", history)
+	}
+}
@@ -0,0 +1,197 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2018 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+// Package ledger keeps track of the cloud resources corebench creates so they can still be torn down
+// when corebench is killed before it gets the chance to clean up after itself.
+package ledger
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/deckarep/corebench/pkg/utility"
+)
+
+const (
+	ledgerFile = "ledger.json"
+	// lockFileName is locked around every change to the ledger, corebench gc, cleanup and bench can all be
+	// running at once.
+	lockFileName = "ledger.lock"
+)
+
+// Resource is a single cloud resource, it's identified by the name it's created with since
+// most providers only hand out an id once the resource exists.
+type Resource struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// Run is every resource created by a single benchmark run.
+type Run struct {
+	ID        string     `json:"id"`
+	Provider  string     `json:"provider"`
+	Region    string     `json:"region,omitempty"`
+	Created   time.Time  `json:"created"`
+	Kept      bool       `json:"kept,omitempty"`
+	Resources []Resource `json:"resources"`
+}
+
+// Ledger is the list of runs whose resources haven't been torn down yet, persisted to a file. Changes are
+// serialized across goroutines by mu and across corebench processes by a lock on a file next to it.
+type Ledger struct {
+	path string
+	mu   sync.Mutex
+}
+
+// Open returns the ledger kept in the corebench config directory.
+func Open() (*Ledger, error) {
+	dir, err := utility.ConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	return &Ledger{path: filepath.Join(dir, ledgerFile)}, nil
+}
+
+// Runs returns every run in the ledger, oldest first.
+func (l *Ledger) Runs() ([]Run, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.read()
+}
+
+// Record adds a resource to the run, creating the run when it's new. Resources must be recorded
+// before they're created otherwise a crash in between leaks them.
+func (l *Ledger) Record(run Run, resource Resource) error {
+	return l.update(func(runs []Run) []Run {
+		for i := range runs {
+			if runs[i].ID == run.ID {
+				for _, r := range runs[i].Resources {
+					if r == resource {
+						return runs
+					}
+				}
+				runs[i].Resources = append(runs[i].Resources, resource)
+				return runs
+			}
+		}
+		run.Created = time.Now().UTC()
+		run.Resources = []Resource{resource}
+		return append(runs, run)
+	})
+}
+
+// Keep marks the run as intentionally left running.
+func (l *Ledger) Keep(runID string) error {
+	return l.update(func(runs []Run) []Run {
+		for i := range runs {
+			if runs[i].ID == runID {
+				runs[i].Kept = true
+			}
+		}
+		return runs
+	})
+}
+
+// Forget removes the run once all of its resources have been torn down.
+func (l *Ledger) Forget(runID string) error {
+	return l.update(func(runs []Run) []Run {
+		var remaining []Run
+		for _, r := range runs {
+			if r.ID != runID {
+				remaining = append(remaining, r)
+			}
+		}
+		return remaining
+	})
+}
+
+// Lookup returns the run with the given id.
+func (l *Ledger) Lookup(runID string) (Run, bool, error) {
+	runs, err := l.Runs()
+	if err != nil {
+		return Run{}, false, err
+	}
+	for _, r := range runs {
+		if r.ID == runID {
+			return r, true, nil
+		}
+	}
+	return Run{}, false, nil
+}
+
+func (l *Ledger) update(fn func([]Run) []Run) (err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	unlock, err := utility.LockFile(filepath.Join(filepath.Dir(l.path), lockFileName))
+	if err != nil {
+		return fmt.Errorf("failed to lock the ledger: %s", err)
+	}
+	defer func() {
+		if unlockErr := unlock(); err == nil {
+			err = unlockErr
+		}
+	}()
+
+	runs, err := l.read()
+	if err != nil {
+		return err
+	}
+	return l.write(fn(runs))
+}
+
+func (l *Ledger) read() ([]Run, error) {
+	data, err := ioutil.ReadFile(l.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var runs []Run
+	if err := json.Unmarshal(data, &runs); err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+// write replaces the ledger through a rename so it's never left half written.
+func (l *Ledger) write(runs []Run) error {
+	if runs == nil {
+		runs = []Run{}
+	}
+	data, err := json.MarshalIndent(runs, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := l.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.path)
+}
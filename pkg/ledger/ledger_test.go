@@ -0,0 +1,208 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2018 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package ledger
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func testLedger(t *testing.T) *Ledger {
+	dir, err := ioutil.TempDir("", "corebench-ledger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return &Ledger{path: filepath.Join(dir, ledgerFile)}
+}
+
+func TestMissingFile(t *testing.T) {
+	l := testLedger(t)
+
+	runs, err := l.Runs()
+	if err != nil || len(runs) != 0 {
+		t.Fatalf("Runs() on a missing ledger = %v, %v, want no runs and no error", runs, err)
+	}
+	if _, ok, err := l.Lookup("r1"); ok || err != nil {
+		t.Errorf("Lookup() on a missing ledger = %v, %v, want not found and no error", ok, err)
+	}
+	if err := l.Forget("r1"); err != nil {
+		t.Errorf("Forget() on a missing ledger failed: %s", err)
+	}
+	if err := l.Keep("r1"); err != nil {
+		t.Errorf("Keep() on a missing ledger failed: %s", err)
+	}
+	if runs, _ := l.Runs(); len(runs) != 0 {
+		t.Errorf("Forget() and Keep() of unknown runs left %v in the ledger", runs)
+	}
+}
+
+func TestRecord(t *testing.T) {
+	stack := Resource{Kind: "stack", Name: "corebench-r1"}
+	keyPair := Resource{Kind: "key-pair", Name: "corebench-r1"}
+	droplet := Resource{Kind: "droplet", Name: "corebench-r2"}
+
+	tests := []struct {
+		name    string
+		records []Run
+		with    []Resource
+		want    map[string][]Resource
+	}{
+		{
+			name:    "new run",
+			records: []Run{{ID: "r1", Provider: "aws"}},
+			with:    []Resource{stack},
+			want:    map[string][]Resource{"r1": {stack}},
+		},
+		{
+			name:    "same resource twice",
+			records: []Run{{ID: "r1", Provider: "aws"}, {ID: "r1", Provider: "aws"}},
+			with:    []Resource{stack, stack},
+			want:    map[string][]Resource{"r1": {stack}},
+		},
+		{
+			name:    "same name, another kind",
+			records: []Run{{ID: "r1", Provider: "aws"}, {ID: "r1", Provider: "aws"}},
+			with:    []Resource{stack, keyPair},
+			want:    map[string][]Resource{"r1": {stack, keyPair}},
+		},
+		{
+			name:    "two runs",
+			records: []Run{{ID: "r1", Provider: "aws"}, {ID: "r2", Provider: "digitalocean"}, {ID: "r1", Provider: "aws"}},
+			with:    []Resource{stack, droplet, keyPair},
+			want:    map[string][]Resource{"r1": {stack, keyPair}, "r2": {droplet}},
+		},
+	}
+	for _, tt := range tests {
+		l := testLedger(t)
+		for i, run := range tt.records {
+			if err := l.Record(run, tt.with[i]); err != nil {
+				t.Fatalf("%s: Record() failed: %s", tt.name, err)
+			}
+		}
+
+		runs, err := l.Runs()
+		if err != nil {
+			t.Fatalf("%s: Runs() failed: %s", tt.name, err)
+		}
+		if len(runs) != len(tt.want) {
+			t.Errorf("%s: %d runs recorded, want %d", tt.name, len(runs), len(tt.want))
+		}
+		for _, run := range runs {
+			if run.Created.IsZero() {
+				t.Errorf("%s: run %s has no created time", tt.name, run.ID)
+			}
+			if fmt.Sprint(run.Resources) != fmt.Sprint(tt.want[run.ID]) {
+				t.Errorf("%s: run %s resources = %v, want %v", tt.name, run.ID, run.Resources, tt.want[run.ID])
+			}
+		}
+	}
+}
+
+func TestKeepAndForget(t *testing.T) {
+	l := testLedger(t)
+	for _, id := range []string{"r1", "r2", "r3"} {
+		if err := l.Record(Run{ID: id, Provider: "aws"}, Resource{Kind: "stack", Name: "corebench-" + id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := l.Keep("r2"); err != nil {
+		t.Fatalf("Keep() failed: %s", err)
+	}
+	if err := l.Forget("r1"); err != nil {
+		t.Fatalf("Forget() failed: %s", err)
+	}
+
+	runs, err := l.Runs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 || runs[0].ID != "r2" || runs[1].ID != "r3" {
+		t.Fatalf("runs after forgetting r1 = %v, want r2 and r3 in order", runs)
+	}
+	if !runs[0].Kept || runs[1].Kept {
+		t.Errorf("kept = %v and %v, want only r2 kept", runs[0].Kept, runs[1].Kept)
+	}
+
+	if _, ok, _ := l.Lookup("r1"); ok {
+		t.Errorf("Lookup() found the forgotten run r1")
+	}
+	if run, ok, _ := l.Lookup("r2"); !ok || !run.Kept {
+		t.Errorf("Lookup(r2) = %v, %v, want the kept run", run, ok)
+	}
+}
+
+// TestRecordAcrossProcesses records from several processes at once, like corebench gc, cleanup and bench
+// running side by side, none of the records may be lost.
+func TestRecordAcrossProcesses(t *testing.T) {
+	const processes, records = 4, 25
+	l := testLedger(t)
+
+	var cmds []*exec.Cmd
+	for p := 0; p < processes; p++ {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestLedgerHelperProcess$")
+		cmd.Env = append(os.Environ(),
+			"COREBENCH_LEDGER_HELPER="+l.path, fmt.Sprintf("COREBENCH_LEDGER_RUN=p%d", p))
+		cmd.Stderr = os.Stderr
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		cmds = append(cmds, cmd)
+	}
+	for _, cmd := range cmds {
+		if err := cmd.Wait(); err != nil {
+			t.Fatalf("helper process failed: %s", err)
+		}
+	}
+
+	runs, err := l.Runs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var total int
+	for _, run := range runs {
+		total += len(run.Resources)
+	}
+	if len(runs) != processes || total != processes*records {
+		t.Errorf("%d runs with %d resources recorded, want %d runs with %d", len(runs), total, processes, processes*records)
+	}
+}
+
+// TestLedgerHelperProcess isn't a test, it's the process TestRecordAcrossProcesses starts.
+func TestLedgerHelperProcess(t *testing.T) {
+	path := os.Getenv("COREBENCH_LEDGER_HELPER")
+	if path == "" {
+		return
+	}
+	l := &Ledger{path: path}
+	run := Run{ID: os.Getenv("COREBENCH_LEDGER_RUN"), Provider: "aws"}
+	for i := 0; i < 25; i++ {
+		if err := l.Record(run, Resource{Kind: "instance", Name: fmt.Sprintf("%s-%d", run.ID, i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
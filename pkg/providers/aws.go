@@ -22,14 +22,16 @@ SOFTWARE.
 package providers
 
 import (
-	"bufio"
 	"context"
 	"fmt"
-	"os"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/deckarep/corebench/pkg/ledger"
+	"github.com/deckarep/corebench/pkg/repo"
 	"github.com/deckarep/corebench/pkg/ssh"
+	"github.com/deckarep/corebench/pkg/toolchain"
 	"github.com/deckarep/corebench/pkg/utility"
 	log "github.com/sirupsen/logrus"
 
@@ -38,41 +40,72 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws/external"
 	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
-	// "github.com/aws/aws-sdk-go-v2/service/pricing"
+	"github.com/aws/aws-sdk-go-v2/service/pricing"
 )
 
 type AwsProvider struct {
-	client *ec2.EC2
-	cfn    *cloudformation.CloudFormation
-	// TODO: add pricing to size cmd
-	// pricing      *pricing.Pricing
+	client       *ec2.EC2
+	cfn          *cloudformation.CloudFormation
+	pricing      *pricing.Pricing
 	instanceType string
-	repoLastPath string
-	Keyfile      string
-	sshKeys      string
+	region       string
+	ledger       *ledger.Ledger
+	// source is the repository under test and toolchains the go versions it's benchmarked with, they're resolved
+	// when the run starts.
+	source     *repo.Source
+	toolchains []*toolchain.Toolchain
 }
 
-var (
-	privateKey string
-	pairName   string = "corebench"
-	awsRegion  string = "us-east-1"
+const (
+	// awsCanonicalOwnerID is the account Canonical publishes the official Ubuntu AMIs under.
+	awsCanonicalOwnerID = "099720109477"
+	// awsUbuntuImageNameFmt matches the Ubuntu server AMIs for a given architecture.
+	awsUbuntuImageNameFmt = "ubuntu/images/hvm-ssd/ubuntu-bionic-18.04-%s-server-*"
+	// awsPricingRegion is where the pricing api endpoint lives.
+	awsPricingRegion = "us-east-1"
+	// awsStackName is the name of the cloudformation stack.
+	awsStackName = "corebench"
+	// awsStackBootstrapEstimate and awsDirectBootstrapEstimate are roughly how long it takes until the
+	// benchmarks can start, they're only used to estimate the cost.
+	awsStackBootstrapEstimate  = 6 * time.Minute
+	awsDirectBootstrapEstimate = 3 * time.Minute
+	// awsStackSignalTimeout is how long cloudformation waits for a bootstrap that installs a single go release
+	// to signal it's finished before rolling the stack back. One that builds tip, installs several toolchains
+	// or packages, or runs a setup script gets at least awsStackSlowSignalTimeout, plus
+	// awsStackToolchainTimeout for each toolchain past the first.
+	awsStackSignalTimeout     = 5 * time.Minute
+	awsStackSlowSignalTimeout = 20 * time.Minute
+	awsStackToolchainTimeout  = 5 * time.Minute
 )
 
-func NewAwsProvider() Provider {
+// NewAwsProvider returns an aws provider which operates against the given region.
+func NewAwsProvider(region string) Provider {
+	p, err := newAwsProvider(region)
+	if err != nil {
+		panic("unable to load SDK config, " + err.Error())
+	}
+	return p
+}
+
+// newAwsProvider is NewAwsProvider returning the error for when AWS is optional rather than required.
+func newAwsProvider(region string) (*AwsProvider, error) {
 	cfg, err := external.LoadDefaultAWSConfig(
 		external.WithSharedConfigProfile("default"))
 	if err != nil {
-		panic("unable to load SDK config, " + err.Error())
+		return nil, err
 	}
-	// TODO: force region if sizecmd to get around issue with pricing api composing endpoint out of default region
-	cfg.Region = awsRegion
+	cfg.Region = region
+
+	// The pricing api is only served out of a couple of regions regardless of the region being priced.
+	pricingCfg := cfg.Copy()
+	pricingCfg.Region = awsPricingRegion
 
 	return &AwsProvider{
-		client: ec2.New(cfg),
-		cfn:    cloudformation.New(cfg),
-		// TODO: add pricing to size cmd
-		// pricing: pricing.New(cfg),
-	}
+		region:  region,
+		client:  ec2.New(cfg),
+		cfn:     cloudformation.New(cfg),
+		pricing: pricing.New(pricingCfg),
+	}, nil
 }
 
 func (p *AwsProvider) List(ctx context.Context) error {
@@ -121,252 +154,354 @@ func (p *AwsProvider) List(ctx context.Context) error {
 	return nil
 }
 
+// SetKeys is a no-op on aws: a key pair is generated for every run and removed along with the instance.
 func (p *AwsProvider) SetKeys(keys []string) {
-	if p.checkKeypair(keys) != false {
-		p.deleteKeypair(keys)
-	}
-	p.sshKeys = p.createKeypair(keys)
-	p.saveKeypair(p.sshKeys)
-
 }
 
-func (p *AwsProvider) Sizes(ctx context.Context) error {
-
-	// TODO: implement pricing api integration, including horrorshow error handling
-	// svc := p.pricing
-	// 	input := &pricing.GetAttributeValuesInput{
-	// 		AttributeName: aws.String("volumeType"),
-	// 		MaxResults:    aws.Int64(2),
-	// 		ServiceCode:   aws.String("AmazonEC2"),
-	// 	}
-	//
-	// 	req := svc.GetAttributeValuesRequest(input)
-	// 	result, err := req.Send()
-	// 	if err != nil {
-	// 		if aerr, ok := err.(awserr.Error); ok {
-	// 			switch aerr.Code() {
-	// 			case pricing.ErrCodeInternalErrorException:
-	// 				fmt.Println(pricing.ErrCodeInternalErrorException, aerr.Error())
-	// 			case pricing.ErrCodeInvalidParameterException:
-	// 				fmt.Println(pricing.ErrCodeInvalidParameterException, aerr.Error())
-	// 			case pricing.ErrCodeNotFoundException:
-	// 				fmt.Println(pricing.ErrCodeNotFoundException, aerr.Error())
-	// 			case pricing.ErrCodeInvalidNextTokenException:
-	// 				fmt.Println(pricing.ErrCodeInvalidNextTokenException, aerr.Error())
-	// 			case pricing.ErrCodeExpiredNextTokenException:
-	// 				fmt.Println(pricing.ErrCodeExpiredNextTokenException, aerr.Error())
-	// 			default:
-	// 				fmt.Println(aerr.Error())
-	// 			}
-	// 		} else {
-	// 			fmt.Println(err.Error())
-	// 		}
-	// 		return nil
-	// 	}
+func (p *AwsProvider) Term(ctx context.Context, settings ProviderTermSettings) error {
+	if err := p.termInstances(ctx, settings); err != nil {
+		return err
+	}
 
+	// The cloudformation stack is matched by its name.
+	if settings.ShouldTerm(awsStackName, "") {
+		instances, err := p.stackInstances(awsStackName)
+		if err != nil {
+			return err
+		}
+		if err := p.cleanup(ctx, awsStackName); err != nil {
+			return fmt.Errorf("stack %q is still alive and billing, delete it manually: %s", awsStackName, err)
+		}
+		for _, instance := range instances {
+			p.deleteInstanceKey(ctx, instance)
+		}
+	}
 	return nil
 }
 
-func (p *AwsProvider) Term(ctx context.Context, settings ProviderTermSettings) error {
-	p.cleanup(pairName)
-	return nil
+// stackInstances returns the instances created by a cloudformation stack.
+func (p *AwsProvider) stackInstances(stackName string) ([]ec2.Instance, error) {
+	svc := p.client
+	input := &ec2.DescribeInstancesInput{
+		Filters: []ec2.Filter{
+			{
+				Name:   aws.String("tag:aws:cloudformation:stack-name"),
+				Values: []string{stackName},
+			},
+		},
+	}
+	req := svc.DescribeInstancesRequest(input)
+	result, err := req.Send()
+	if err != nil {
+		return nil, err
+	}
+
+	var instances []ec2.Instance
+	for _, reservation := range result.Reservations {
+		instances = append(instances, reservation.Instances...)
+	}
+	return instances, nil
 }
 
-func (p *AwsProvider) cleanup(keyname string) error {
+// cleanup deletes the stack and blocks until cloudformation has finished deleting everything in it.
+func (p *AwsProvider) cleanup(ctx context.Context, keyname string) error {
 	svc := p.cfn
 	input := &cloudformation.DeleteStackInput{
 		StackName: aws.String(keyname),
 	}
-	req := svc.DeleteStackRequest(input)
-	_, err := req.Send()
-	// the below error check is essentially redundant, aws api will only return error on malformed request
-	p.genericAwsErrorCheck(err)
+	err := awsDelete(ctx, func() error {
+		_, err := svc.DeleteStackRequest(input).Send()
+		return err
+	})
+	if err != nil {
+		return err
+	}
 	log.Infof("Cleaning up resources...")
 	log.Infof("Stack deletion request sent for \"%v\"", *input.StackName)
-	return nil
+	return p.waitForStackDeleted(ctx, keyname)
 }
 
-func (p *AwsProvider) createKeypair(keypair []string) string {
+// availabilityZone returns the zone requested in the settings, defaulting to the first zone of the region.
+func (p *AwsProvider) availabilityZone(settings ProviderSpinSettings) (string, error) {
+	zone := p.region + "a"
+	if s := awsSpinSettings(settings); s.Zone != "" {
+		zone = s.Zone
+	}
+	if !strings.HasPrefix(zone, p.region) {
+		return "", fmt.Errorf("availability zone %q is not in region %q", zone, p.region)
+	}
+	return zone, nil
+}
+
+// lookupAMI finds the most recent Ubuntu AMI published by Canonical in the provider's region.
+func (p *AwsProvider) lookupAMI(arch string) (string, error) {
 	svc := p.client
-	input := &ec2.CreateKeyPairInput{
-		KeyName: aws.String(pairName),
+	input := &ec2.DescribeImagesInput{
+		Owners: []string{awsCanonicalOwnerID},
+		Filters: []ec2.Filter{
+			{
+				Name:   aws.String("name"),
+				Values: []string{fmt.Sprintf(awsUbuntuImageNameFmt, arch)},
+			},
+			{
+				Name:   aws.String("state"),
+				Values: []string{"available"},
+			},
+			{
+				Name:   aws.String("virtualization-type"),
+				Values: []string{"hvm"},
+			},
+		},
 	}
-	req := svc.CreateKeyPairRequest(input)
+	req := svc.DescribeImagesRequest(input)
 	result, err := req.Send()
 	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "InvalidKeyPair.Duplicate" {
-			log.Infof("Keypair %q already exists", pairName)
-			return ""
-		}
-		log.Fatalf("Unable to create key pair: %s, %v.", pairName, err)
+		return "", err
+	}
+	if len(result.Images) == 0 {
+		return "", fmt.Errorf("no ubuntu %s images found in region %q", arch, p.region)
 	}
-	log.Infof("Created keypair %q", *result.KeyName)
-	privateKey = *result.KeyMaterial
-	return privateKey
+
+	// CreationDate is an ISO 8601 timestamp so a lexical sort is chronological.
+	images := result.Images
+	sort.Slice(images, func(i, j int) bool {
+		return aws.StringValue(images[i].CreationDate) > aws.StringValue(images[j].CreationDate)
+	})
+	return aws.StringValue(images[0].ImageId), nil
 }
 
-func (p *AwsProvider) saveKeypair(privateKey string) error {
-	filename := fmt.Sprintf("%s.pem", pairName)
-	fileHandle, err := os.Create(filename)
-	if err != nil {
-		log.Fatalf("Failed to create file %s!", filename)
+// awsSpinSettings returns the aws specific settings, generic settings get the aws defaults.
+func awsSpinSettings(settings ProviderSpinSettings) *AwsSpinSettings {
+	if s, ok := settings.(*AwsSpinSettings); ok {
+		return s
 	}
-	os.Chmod(filename, 0600)
-	writer := bufio.NewWriter(fileHandle)
-	defer fileHandle.Close()
+	return &AwsSpinSettings{}
+}
 
-	fmt.Fprintln(writer, privateKey)
-	writer.Flush()
+// spotSettings returns whether the instance should be requested on the spot market and at what max price.
+func (p *AwsProvider) spotSettings(settings ProviderSpinSettings) (bool, string) {
+	s := awsSpinSettings(settings)
+	return s.Spot, s.SpotMaxPrice
+}
 
-	log.Infof("Saved new keypair to file: %s", filename)
-	p.Keyfile = filename
-	return nil
+// marketType is the market the instance is requested on, as named in the cloudformation template.
+func (p *AwsProvider) marketType(settings ProviderSpinSettings) string {
+	if spot, _ := p.spotSettings(settings); spot {
+		return "spot"
+	}
+	return "on-demand"
 }
 
-func (p *AwsProvider) checkKeypair(keypair []string) bool {
-	doesexist := false
+// spotInterrupted reports whether the instance was reclaimed by the spot market.
+func (p *AwsProvider) spotInterrupted(instanceID string) bool {
 	svc := p.client
-	input := &ec2.DescribeKeyPairsInput{
-		KeyNames: strings.Split(pairName, ","),
+	input := &ec2.DescribeInstancesInput{
+		InstanceIds: []string{instanceID},
 	}
-	req := svc.DescribeKeyPairsRequest(input)
-	_, err := req.Send()
+	req := svc.DescribeInstancesRequest(input)
+	result, err := req.Send()
 	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "InvalidKeyPair.NotFound" {
-			log.Infof("Key pair %q does not exist", pairName)
-			doesexist = false
-			return doesexist
+		log.Warn("Failed to describe instance: ", err)
+		return false
+	}
+	for _, reservation := range result.Reservations {
+		for _, instance := range reservation.Instances {
+			if instance.StateReason != nil && aws.StringValue(instance.StateReason.Code) == "Server.SpotInstanceTermination" {
+				return true
+			}
 		}
 	}
-	doesexist = true
-	log.Infof("Keypair exists! Cleaning up and creating new keypair...")
-	return doesexist
+	return false
 }
 
-func (p *AwsProvider) deleteKeypair(keypair []string) error {
-	svc := p.client
-	input := &ec2.DeleteKeyPairInput{
-		KeyName: aws.String(pairName),
-	}
-	req := svc.DeleteKeyPairRequest(input)
-	_, err := req.Send()
-	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "InvalidKeyPair.Duplicate" {
-			log.Infof("Key pair %q does not exist, creating..", pairName)
+// waitForStackDeleted blocks until the stack no longer exists, giving up after awsStackDeleteTimeout.
+func (p *AwsProvider) waitForStackDeleted(ctx context.Context, stackName string) error {
+	svc := p.cfn
+	deadline := time.Now().Add(awsStackDeleteTimeout)
+	for time.Now().Before(deadline) {
+		input := &cloudformation.DescribeStacksInput{
+			StackName: aws.String(stackName),
+		}
+		req := svc.DescribeStacksRequest(input)
+		result, err := req.Send()
+		if err != nil {
+			// A deleted stack can no longer be described by name.
+			if aerr, ok := err.(awserr.Error); ok && strings.Contains(aerr.Message(), "does not exist") {
+				return nil
+			}
+			return err
+		}
+		for _, stack := range result.Stacks {
+			switch stack.StackStatus {
+			case "DELETE_COMPLETE":
+				return nil
+			case "DELETE_FAILED":
+				return fmt.Errorf("stack %q failed to delete", stackName)
+			}
+		}
+		log.Info("Waiting for stack deletion to complete...")
+		if err := utility.Sleep(ctx, 10*time.Second); err != nil {
+			return fmt.Errorf("stopped waiting for stack %q to be deleted: %s", stackName, err)
 		}
-		log.Fatalf("Unable to delete key pair: %s, %v.", pairName, err)
 	}
-	return nil
+	return fmt.Errorf("stack %q is still alive %s after deleting it", stackName, awsStackDeleteTimeout)
 }
 
-func (p *AwsProvider) processCfnTemplate(settings ProviderSpinSettings) string {
-	p.repoLastPath = utility.GitPathLast(settings.GitURL())
-	finalCfnTemplate :=
-		strings.Replace(CfnTemplate, "${go-version}", fmt.Sprintf(goVersionFmt, settings.GoVersion()), -1)
-	finalCfnTemplate =
-		strings.Replace(finalCfnTemplate, "${git-repo}", settings.GitURL(), -1)
-	finalCfnTemplate =
-		strings.Replace(finalCfnTemplate, "${git-repo-last-path}", p.repoLastPath, -1)
-	finalCfnTemplate =
-		strings.Replace(finalCfnTemplate, "${keypair}", pairName, -1)
-	finalCfnTemplate =
-		strings.Replace(finalCfnTemplate, "${instancetype}", settings.InstanceTypeString(), -1)
-	finalCfnTemplate =
-		strings.Replace(finalCfnTemplate, "${awsregion}", awsRegion, -1)
-
-	return finalCfnTemplate
+// templateData is what the aws templates are rendered with, the bootstrap is shared by the cloudformation
+// and direct launch modes.
+func (p *AwsProvider) templateData(settings ProviderSpinSettings, spec *awsLaunchSpec) templateData {
+	data := newTemplateData(settings, p.source, p.toolchains, "ubuntu", spec.size.GoArch)
+	data.SpotWatch, _ = p.spotSettings(settings)
+	return data
 }
 
-func (p *AwsProvider) processBenchCommandTemplate(settings ProviderSpinSettings) string {
-	AwsBenchCmd :=
-		strings.Replace(AwsBenchCommandTemplate, "${git-repo}", settings.GitURL(), -1)
-	AwsBenchCmd =
-		strings.Replace(AwsBenchCmd, "${cpu-count}", settings.Cpus(), -1)
-	AwsBenchCmd =
-		strings.Replace(AwsBenchCmd, "${benchmem-setting}", settings.BenchMemString(), -1)
-	AwsBenchCmd =
-		strings.Replace(AwsBenchCmd, "${bench-regex}", settings.Regex(), -1)
-	AwsBenchCmd =
-		strings.Replace(AwsBenchCmd, "${bench-count}", fmt.Sprintf("%d", settings.Count()), -1)
+func (p *AwsProvider) processCfnTemplate(settings ProviderSpinSettings, spec *awsLaunchSpec) string {
+	data := p.templateData(settings, spec)
+	_, spotMaxPrice := p.spotSettings(settings)
+	data.Stack = &awsStackData{
+		KeyName:      spec.key.name,
+		AMI:          spec.ami,
+		InstanceType: spec.size.InstanceType,
+		Zone:         spec.zone,
+		SSHCidr:      spec.sshCidr,
+		MarketType:   p.marketType(settings),
+		SpotMaxPrice: spotMaxPrice,
+		// !Sub would otherwise substitute ${...} in the bootstrap, a setup script's shell variables included.
+		Bootstrap:     strings.Replace(strings.TrimSpace(render("bootstrap", data)), "${", "${!", -1),
+		SignalTimeout: fmt.Sprintf("PT%dM", int(stackSignalTimeout(data).Minutes())),
+	}
+	return render("cfn", data)
+}
 
-	// Should be last, turns on the benchstat summary
-	if settings.Stat() {
-		AwsBenchCmd = AwsBenchCmd + AwsBenchStatTemplate
+// stackSignalTimeout is how long cloudformation waits for the bootstrap to signal it's finished, which depends
+// on how much it has to install.
+func stackSignalTimeout(data templateData) time.Duration {
+	slow := len(data.Toolchains) > 1 || len(data.AptPackages) > 0 || data.SetupScript != ""
+	for _, g := range data.Toolchains {
+		slow = slow || g.Tip
 	}
+	if !slow {
+		return awsStackSignalTimeout
+	}
+	timeout := awsStackSlowSignalTimeout
+	if extra := len(data.Toolchains) - 1; extra > 0 {
+		timeout += time.Duration(extra) * awsStackToolchainTimeout
+	}
+	return timeout
+}
 
-	return fmt.Sprintf("%s && %s", AwsBenchReadyScript, AwsBenchCmd)
+func (p *AwsProvider) processBenchCommandTemplate(settings ProviderSpinSettings, spec *awsLaunchSpec) string {
+	return render("bench", p.templateData(settings, spec))
 }
 
-func (p *AwsProvider) genericAwsErrorCheck(err error) error {
+// awsLaunchSpec is everything resolved about an instance before it's launched.
+type awsLaunchSpec struct {
+	runID   string
+	zone    string
+	ami     string
+	sshCidr string
+	size    *awsSize
+	key     *awsRunKey
+}
+
+// resolveLaunchSpec looks up the size of the instance type, and the zone and matching ami to launch it with.
+func (p *AwsProvider) resolveLaunchSpec(ctx context.Context, settings ProviderSpinSettings) (*awsLaunchSpec, error) {
+	zone, err := p.availabilityZone(settings)
 	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok {
-			switch aerr.Code() {
-			default:
-				log.Fatalf(aerr.Error())
-			}
-		} else {
-			log.Fatalf(err.Error())
-		}
+		return nil, err
 	}
-	return nil
+
+	var size *awsSize
+	if settings.InstanceTypeString() != "" {
+		size, err = p.lookupSize(settings.InstanceTypeString())
+	} else {
+		size, err = p.selectSize(ctx, awsSpinSettings(settings).Family, settings.MaxCpu())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up instance type: %s", err)
+	}
+
+	// Hyperthreads share a physical core's execution units, so scaling past the cores isn't linear.
+	if maxCpu := settings.MaxCpu(); size.Cores > 0 && maxCpu > size.Cores {
+		log.Warnf("--cpu value of %d exceeds the %d physical cores of %s, hyperthreads will skew the scaling results", maxCpu, size.Cores, size.InstanceType)
+	}
+
+	if err := checkArchives(p.toolchains, size.GoArch); err != nil {
+		return nil, err
+	}
+
+	ami, err := p.lookupAMI(size.GoArch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up ubuntu ami: %s", err)
+	}
+
+	sshCidr, err := utility.CallerCIDR(settings.SSHCidr())
+	if err != nil {
+		return nil, err
+	}
+	return &awsLaunchSpec{
+		runID:   utility.NewInstanceID(),
+		zone:    zone,
+		ami:     ami,
+		sshCidr: sshCidr,
+		size:    size,
+	}, nil
 }
 
-func (p *AwsProvider) Spinup(ctx context.Context, settings ProviderSpinSettings) error {
+// awsInstance is a provisioned benchmark instance.
+type awsInstance struct {
+	id string
+	ip string
+}
+
+// spinupStack provisions the instance along with its own vpc through a cloudformation stack.
+func (p *AwsProvider) spinupStack(ctx context.Context, settings ProviderSpinSettings, spec *awsLaunchSpec) (*awsInstance, error) {
 	var instanceid string
 	svc := p.cfn
-	finalCfnTemplate := p.processCfnTemplate(settings)
+	finalCfnTemplate := p.processCfnTemplate(settings, spec)
+	if err := p.record(spec.runID, awsResourceStack, awsStackName); err != nil {
+		return nil, err
+	}
 	input := &cloudformation.CreateStackInput{
-		StackName:    aws.String(pairName),
+		StackName:    aws.String(awsStackName),
 		TemplateBody: aws.String(finalCfnTemplate),
 	}
 	req := svc.CreateStackRequest(input)
-	log.Infof("About to provision Cloudformation stack \"%v\" with instance type \"%v\"", *input.StackName, settings.InstanceTypeString())
-	if !utility.PromptConfirmation("Continue provisioning? (Yy)es/(Nn)o") {
-		log.Info("Cleaning up...")
-		p.deleteKeypair(strings.Split(pairName, ","))
-		log.Info("Quitting")
-		return nil
-	}
 	result, err := req.Send()
-	if p.genericAwsErrorCheck(err) == nil {
-		log.Infof("Stack creation request sent: %v\n", result)
+	if err != nil {
+		return nil, err
 	}
+	log.Infof("Stack creation request sent: %v\n", result)
 
 	notready := true
 	for notready {
 		statusinput := &cloudformation.DescribeStacksInput{
-			StackName: aws.String(pairName),
+			StackName: aws.String(awsStackName),
 		}
 		statusreq := svc.DescribeStacksRequest(statusinput)
 		statusresult, err := statusreq.Send()
 		if err != nil {
-			if aerr, ok := err.(awserr.Error); ok {
-				switch aerr.Code() {
-				default:
-					fmt.Println(aerr.Error())
-				}
-			} else {
-				fmt.Println(err.Error())
-			}
-			return nil
-		} else {
-			for _, stackstatus := range statusresult.Stacks {
-				log.Infof("Waiting for stack resource creation to complete...")
-				if stackstatus.StackStatus == "CREATE_COMPLETE" {
-					log.Infof("Good news! Stack status is now %v\n", stackstatus.StackStatus)
-					notready = false
-				} else {
-					time.Sleep(30 * time.Second)
+			return nil, err
+		}
+		for _, stackstatus := range statusresult.Stacks {
+			log.Infof("Waiting for stack resource creation to complete...")
+			switch stackstatus.StackStatus {
+			case "CREATE_COMPLETE":
+				log.Infof("Good news! Stack status is now %v\n", stackstatus.StackStatus)
+				notready = false
+			case "CREATE_IN_PROGRESS":
+				if err := utility.Sleep(ctx, 30*time.Second); err != nil {
+					return nil, err
 				}
+			default:
+				return nil, fmt.Errorf("stack creation failed with status %v", stackstatus.StackStatus)
 			}
 		}
 	}
 
 	var chosenIP string
-	const maxDialAttempts = 20
 
 	// Spin wait - TODO: make this more graceful.
-advance_to_ssh:
 	for {
 		svc := p.client
 		input := &ec2.DescribeInstancesInput{
@@ -376,52 +511,247 @@ advance_to_ssh:
 					Values: []string{"running", "pending", "stopped"},
 				},
 				{
-					Name:   aws.String("tag-value"),
-					Values: []string{"corebench"},
+					Name:   aws.String("tag:aws:cloudformation:stack-name"),
+					Values: []string{awsStackName},
 				},
 			},
 		}
 		req := svc.DescribeInstancesRequest(input)
 		result, err := req.Send()
-		p.genericAwsErrorCheck(err)
+		if err != nil {
+			return nil, err
+		}
 
 		var ip string
 		for _, reservation := range result.Reservations {
 			for _, instance := range reservation.Instances {
-				if len(reservation.Instances) == 0 {
-					fmt.Println("")
-					log.Infof("No Instances found! Check the AWS Console", err)
-					return nil
-				}
-				ip = *instance.PublicIpAddress
-				instanceid = *instance.InstanceId
+				ip = aws.StringValue(instance.PublicIpAddress)
+				instanceid = aws.StringValue(instance.InstanceId)
 			}
 		}
 
 		if ip != "" {
 			chosenIP = ip
-			err = ssh.PollSSH(chosenIP + ":22")
-			if err == nil {
-				break advance_to_ssh
+			if err := ssh.PollSSH(ctx, chosenIP+":22"); err != nil {
+				return nil, err
 			}
+			break
 		}
+		if err := utility.Sleep(ctx, 5*time.Second); err != nil {
+			return nil, err
+		}
+	}
+	if err := utility.Sleep(ctx, 30*time.Second); err != nil {
+		return nil, err
+	}
+
+	return &awsInstance{
+		id: instanceid,
+		ip: chosenIP,
+	}, nil
+}
+
+func (p *AwsProvider) Spinup(ctx context.Context, settings ProviderSpinSettings) error {
+	source, err := resolveSource(ctx, settings)
+	if err != nil {
+		return err
+	}
+	p.source = source
+
+	if p.toolchains, err = resolveToolchains(ctx, settings); err != nil {
+		return err
+	}
+
+	if settings.DryRun() {
+		return p.dryRun(ctx, settings)
+	}
+
+	book, err := ledger.Open()
+	if err != nil {
+		return err
+	}
+	p.ledger = book
+
+	out, err := newResults(settings.ResultsFile())
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	return p.spinup(ctx, settings, out)
+}
+
+// spinup provisions and benchmarks, it's re-entered when a spot instance is retried on-demand.
+func (p *AwsProvider) spinup(ctx context.Context, settings ProviderSpinSettings, out *results) (err error) {
+	spec, err := p.resolveLaunchSpec(ctx, settings)
+	if err != nil {
+		return err
 	}
-	time.Sleep(time.Second * 30)
-	log.Infof("Instance %v is provisioned and reachable at ip: %v\n", instanceid, chosenIP)
+
+	direct := awsSpinSettings(settings).Direct
+	if direct {
+		log.Infof("About to launch instance type \"%v\" (%s) directly in %v using %v", spec.size.InstanceType, spec.size.GoArch, spec.zone, spec.ami)
+	} else {
+		log.Infof("About to provision Cloudformation stack \"%v\" with instance type \"%v\" (%s) in %v using %v", awsStackName, spec.size.InstanceType, spec.size.GoArch, spec.zone, spec.ami)
+	}
+	if spot, spotMaxPrice := p.spotSettings(settings); spot {
+		if spotMaxPrice == "" {
+			spotMaxPrice = "on-demand price"
+		}
+		log.Infof("Instance will be requested on the spot market (max $/HR: %s)", spotMaxPrice)
+	}
+	log.Infof("SSH access will be restricted to %s", spec.sshCidr)
+	if lifetime := settings.MaxLifetime(); lifetime > 0 {
+		log.Infof("Instance will terminate itself after %s", lifetime)
+	}
+
+	estimate := p.estimateCost(ctx, settings, spec)
+	estimate.log()
+	if err := checkBudget(settings, estimate); err != nil {
+		return err
+	}
+	if !utility.PromptConfirmation("Continue provisioning? (Yy)es/(Nn)o") {
+		log.Info("Quitting")
+		return nil
+	}
+
+	// Everything created from here on is recorded in the ledger and torn down on the way out,
+	// whether the benchmark completes, fails or is interrupted.
+	var instance *awsInstance
+	var bill *billing
+	defer func() {
+		if settings.LeaveRunning() && instance != nil && ctx.Err() == nil {
+			p.ledger.Keep(spec.runID)
+			log.Infof("Leaving AWS resources running! Execute \"ssh ubuntu@%s -i %s\" to connect to the instance", instance.ip, spec.key.file)
+			bill.keep()
+			bill.report(out)
+			return
+		}
+		if terr := teardownRun(p, p.ledger, spec.runID); terr != nil && err == nil {
+			err = terr
+		}
+		bill.report(out)
+	}()
+
+	spec.key, err = p.createRunKey(spec.runID)
+	if err != nil {
+		return fmt.Errorf("failed to create key pair: %s", err)
+	}
+
+	bill = newBilling(spec.runID, "aws", spec.size.InstanceType, estimate.hourly)
+	if direct {
+		instance, err = p.spinupInstance(ctx, settings, spec)
+	} else {
+		instance, err = p.spinupStack(ctx, settings, spec)
+	}
+	if err != nil {
+		return err
+	}
+
+	chosenIP := instance.ip
+	log.Infof("Instance %v is provisioned and reachable at ip: %v\n", instance.id, chosenIP)
 	log.Info("Instance benchmark starting momentarily...\n")
 
-	AwsBenchCmd := p.processBenchCommandTemplate(settings)
+	AwsBenchCmd := p.processBenchCommandTemplate(settings, spec)
 	chosenIP = fmt.Sprintf("ubuntu@%s", chosenIP)
-	err = ssh.ExecuteSSH(chosenIP, AwsBenchCmd)
+
+	if err := fetchSource(ctx, p.templateData(settings, spec), settings, chosenIP, spec.key.file); err != nil {
+		return err
+	}
+
+	out.Label("corebench-provider", "aws")
+	out.Label("corebench-instance-type", spec.size.InstanceType)
+	out.Label("corebench-market", p.marketType(settings))
+	out.Label("goarch", spec.size.GoArch)
+	if p.source.Ref != "" {
+		out.Label("corebench-ref", p.source.Ref)
+	}
+	if p.source.Base != "" {
+		out.Label("corebench-base", p.source.Base)
+	}
+	out.Label("corebench-estimated-cost-usd", fmt.Sprintf("%.4f", estimate.total()))
+
+	err = ssh.ExecuteSSH(ctx, chosenIP, spec.key.file, AwsBenchCmd, out)
+	if spot, _ := p.spotSettings(settings); err != nil && spot && p.spotInterrupted(instance.id) {
+		log.Warn("Spot instance was interrupted, the benchmark results above are partial")
+		if s := settings.(*AwsSpinSettings); s.SpotFallback {
+			// The interrupted instance is torn down and billed here rather than on the way out.
+			instance = nil
+			if err := teardownRun(p, p.ledger, spec.runID); err != nil {
+				return err
+			}
+			bill.report(out)
+			bill = nil
+			log.Info("Retrying the benchmark on an on-demand instance...")
+			onDemand := *s
+			onDemand.Spot = false
+			return p.spinup(ctx, &onDemand, out)
+		}
+		err = nil
+	}
 	if err != nil {
-		log.Fatalln("Failed to SSH: ", err)
+		return fmt.Errorf("failed to SSH: %s", err)
 	}
-	if !settings.LeaveRunning() {
-		defer func() {
-			p.cleanup(pairName)
-		}()
+	return nil
+}
+
+// record notes a resource of the run in the ledger, it must be called before the resource is created.
+func (p *AwsProvider) record(runID, kind, name string) error {
+	run := ledger.Run{
+		ID:       runID,
+		Provider: "aws",
+		Region:   p.region,
+	}
+	return p.ledger.Record(run, ledger.Resource{Kind: kind, Name: name})
+}
+
+// estimateCost prices the instance type and estimates the cost of the run on it.
+func (p *AwsProvider) estimateCost(ctx context.Context, settings ProviderSpinSettings, spec *awsLaunchSpec) costEstimate {
+	p.priceSize(ctx, spec.size)
+	hourly := spec.size.PriceHourly
+	if spot, _ := p.spotSettings(settings); spot && spec.size.SpotHourly > 0 {
+		hourly = spec.size.SpotHourly
+	}
+	bootstrap := awsStackBootstrapEstimate
+	if awsSpinSettings(settings).Direct {
+		bootstrap = awsDirectBootstrapEstimate
+	}
+	return estimateCost(settings, p.source, hourly, bootstrap)
+}
+
+// dryRun resolves everything about the run and prints it without creating any resources.
+func (p *AwsProvider) dryRun(ctx context.Context, settings ProviderSpinSettings) error {
+	spec, err := p.resolveLaunchSpec(ctx, settings)
+	if err != nil {
+		return err
+	}
+	spec.runID = dryRunID
+	spec.key = &awsRunKey{name: fmt.Sprintf(AwsProviderInstanceNameFmt, dryRunID)}
+
+	plan := &dryRunPlan{
+		Provider:     "aws",
+		Region:       p.region,
+		Zone:         spec.zone,
+		Mode:         "stack",
+		InstanceType: spec.size.InstanceType,
+		Vcpus:        spec.size.Vcpus,
+		GoArch:       spec.size.GoArch,
+		Image:        spec.ami,
+		Market:       p.marketType(settings),
+		SSHCidr:      spec.sshCidr,
+		MaxLifetime:  settings.MaxLifetime().String(),
+		GoVersions:   toolchainVersions(p.toolchains),
+		Repository:   p.source.Origin(),
+		Ref:          p.source.Ref,
+		Base:         p.source.Base,
+		Credentials:  credentialsKind(settings),
+		BenchCommand: p.processBenchCommandTemplate(settings, spec),
+	}
+	if awsSpinSettings(settings).Direct {
+		plan.Mode = "direct"
+		plan.Template = p.processUserDataScript(settings, spec)
 	} else {
-		log.Infof("Leaving AWS resources running! Execute \"ssh %s -i %s\" to connect to the instance", chosenIP, p.Keyfile)
+		plan.Template = p.processCfnTemplate(settings, spec)
 	}
-	return nil
+	return plan.print(p.estimateCost(ctx, settings, spec))
 }
@@ -0,0 +1,187 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2018 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package providers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/deckarep/corebench/pkg/ledger"
+	"github.com/deckarep/corebench/pkg/utility"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/awserr"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+)
+
+// The kinds of aws resources recorded in the ledger.
+const (
+	awsResourceKeyPair       = "key-pair"
+	awsResourceStack         = "stack"
+	awsResourceSecurityGroup = "security-group"
+	awsResourceInstance      = "instance"
+)
+
+const (
+	// awsDeleteAttempts is how many times a delete is tried before giving up on it.
+	awsDeleteAttempts = 6
+	// awsInstanceDeleteTimeout is how long a terminated instance may take to really disappear.
+	awsInstanceDeleteTimeout = 10 * time.Minute
+	// awsStackDeleteTimeout is how long a stack may take to finish deleting.
+	awsStackDeleteTimeout = 30 * time.Minute
+)
+
+// awsRetryCodes are the error codes worth retrying a delete on, the rest won't go away by themselves.
+// A security group can't be deleted until the instance using it has finished terminating.
+var awsRetryCodes = map[string]bool{
+	"Throttling":               true,
+	"ThrottlingException":      true,
+	"RequestLimitExceeded":     true,
+	"TooManyRequestsException": true,
+	"InternalError":            true,
+	"ServiceUnavailable":       true,
+	"DependencyViolation":      true,
+	"InvalidGroup.InUse":       true,
+	"RequestExpired":           true,
+	"Unavailable":              true,
+}
+
+// awsDelete retries a delete that was throttled or failed for a transient reason with exponential backoff.
+func awsDelete(ctx context.Context, call func() error) error {
+	return utility.Retry(ctx, awsDeleteAttempts, func() error {
+		err := call()
+		if err == nil {
+			return nil
+		}
+		if aerr, ok := err.(awserr.Error); ok && awsRetryCodes[aerr.Code()] {
+			return err
+		}
+		return utility.Permanent(err)
+	})
+}
+
+// Cleanup tears down the resources recorded for a run, resources that no longer exist are skipped.
+func (p *AwsProvider) Cleanup(ctx context.Context, run ledger.Run) error {
+	keyName := fmt.Sprintf(AwsProviderInstanceNameFmt, run.ID)
+
+	// Resources are torn down in the reverse order they were created so nothing is still in use.
+	for i := len(run.Resources) - 1; i >= 0; i-- {
+		resource := run.Resources[i]
+		var err error
+		switch resource.Kind {
+		case awsResourceInstance:
+			err = p.terminateRunInstances(ctx, run.ID)
+		case awsResourceStack:
+			err = p.deleteRunStack(ctx, resource.Name, keyName)
+		case awsResourceSecurityGroup:
+			err = p.deleteRunSecurityGroups(ctx, run.ID)
+		case awsResourceKeyPair:
+			keyFile, ferr := runKeyFile(resource.Name)
+			if ferr != nil {
+				return ferr
+			}
+			p.deleteRunKey(ctx, &awsRunKey{
+				name: resource.Name,
+				file: keyFile,
+			})
+		default:
+			log.WithField("kind", resource.Kind).Warning("Skipping unknown resource kind")
+		}
+		if err != nil {
+			return fmt.Errorf("failed to delete %s %q: %s", resource.Kind, resource.Name, err)
+		}
+	}
+	return nil
+}
+
+// terminateRunInstances terminates the instances tagged with the run.
+func (p *AwsProvider) terminateRunInstances(ctx context.Context, runID string) error {
+	svc := p.client
+	input := &ec2.DescribeInstancesInput{
+		Filters: []ec2.Filter{
+			{
+				Name:   aws.String("instance-state-name"),
+				Values: []string{"pending", "running", "stopping", "stopped", "shutting-down"},
+			},
+			{
+				Name:   aws.String("tag:" + awsRunTagKey),
+				Values: []string{runID},
+			},
+		},
+	}
+	req := svc.DescribeInstancesRequest(input)
+	result, err := req.Send()
+	if err != nil {
+		return err
+	}
+
+	var alive []string
+	for _, reservation := range result.Reservations {
+		for _, instance := range reservation.Instances {
+			instanceID := aws.StringValue(instance.InstanceId)
+			if err := p.terminateInstance(ctx, instanceID); err != nil {
+				log.WithField("id", instanceID).Error(err)
+				alive = append(alive, instanceID)
+			}
+		}
+	}
+	if len(alive) > 0 {
+		return fmt.Errorf("instances %s are still alive", strings.Join(alive, ", "))
+	}
+	return nil
+}
+
+// deleteRunStack deletes the stack when it was created with the run's key pair, the stack name is shared
+// between runs so a stack created by a later run is left alone.
+func (p *AwsProvider) deleteRunStack(ctx context.Context, stackName, keyName string) error {
+	svc := p.cfn
+	input := &cloudformation.DescribeStacksInput{
+		StackName: aws.String(stackName),
+	}
+	req := svc.DescribeStacksRequest(input)
+	result, err := req.Send()
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && strings.Contains(aerr.Message(), "does not exist") {
+			return nil
+		}
+		return err
+	}
+
+	for _, stack := range result.Stacks {
+		if stack.StackStatus == "DELETE_COMPLETE" {
+			continue
+		}
+		for _, param := range stack.Parameters {
+			if aws.StringValue(param.ParameterKey) == "KeyName" && aws.StringValue(param.ParameterValue) != keyName {
+				log.WithField("stack", stackName).Warning("Stack belongs to another run, leaving it alone")
+				return nil
+			}
+		}
+		return p.cleanup(ctx, stackName)
+	}
+	return nil
+}
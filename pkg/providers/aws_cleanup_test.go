@@ -0,0 +1,87 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2018 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package providers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// awsTestError is an api error with the code, like the ones the sdk returns.
+type awsTestError struct {
+	code string
+}
+
+func (e awsTestError) Error() string   { return e.code + ": failed" }
+func (e awsTestError) Code() string    { return e.code }
+func (e awsTestError) Message() string { return "failed" }
+func (e awsTestError) OrigErr() error  { return nil }
+
+func TestAwsDelete(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantCalls int
+	}{
+		{"success", nil, 1},
+		{"not retryable code", awsTestError{"InvalidGroup.NotFound"}, 1},
+		{"not an api error", errors.New("failed"), 1},
+	}
+
+	for _, tt := range tests {
+		calls := 0
+		err := awsDelete(context.Background(), func() error {
+			calls++
+			return tt.err
+		})
+		if err != tt.err {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.err)
+		}
+		if calls != tt.wantCalls {
+			t.Errorf("%s: got %d calls, want %d", tt.name, calls, tt.wantCalls)
+		}
+	}
+}
+
+func TestAwsDeleteCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	throttled := awsTestError{"Throttling"}
+	calls := 0
+	start := time.Now()
+	err := awsDelete(ctx, func() error {
+		calls++
+		return throttled
+	})
+	if err != throttled {
+		t.Errorf("got error %v, want %v", err, throttled)
+	}
+	if calls != 1 {
+		t.Errorf("got %d calls, want 1", calls)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("returned after %s, want right away", elapsed)
+	}
+}
@@ -0,0 +1,453 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2018 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package providers
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/deckarep/corebench/pkg/ssh"
+	"github.com/deckarep/corebench/pkg/utility"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+)
+
+const (
+	// awsRunTagKey tags every resource launched directly with the id of the run that created it.
+	awsRunTagKey = "corebench-run"
+)
+
+func (p *AwsProvider) processUserData(settings ProviderSpinSettings, spec *awsLaunchSpec) string {
+	return base64.StdEncoding.EncodeToString([]byte(p.processUserDataScript(settings, spec)))
+}
+
+// processUserDataScript renders the user data before it's encoded.
+func (p *AwsProvider) processUserDataScript(settings ProviderSpinSettings, spec *awsLaunchSpec) string {
+	return render("user-data", p.templateData(settings, spec))
+}
+
+// defaultSubnet finds the default subnet of the default vpc in the given zone.
+func (p *AwsProvider) defaultSubnet(zone string) (*ec2.Subnet, error) {
+	svc := p.client
+	input := &ec2.DescribeSubnetsInput{
+		Filters: []ec2.Filter{
+			{
+				Name:   aws.String("availability-zone"),
+				Values: []string{zone},
+			},
+			{
+				Name:   aws.String("default-for-az"),
+				Values: []string{"true"},
+			},
+		},
+	}
+	req := svc.DescribeSubnetsRequest(input)
+	result, err := req.Send()
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Subnets) == 0 {
+		return nil, fmt.Errorf("no default vpc subnet exists in %q, specify a --subnet or use cloudformation mode", zone)
+	}
+	return &result.Subnets[0], nil
+}
+
+// lookupSubnet describes a user supplied subnet.
+func (p *AwsProvider) lookupSubnet(subnetID string) (*ec2.Subnet, error) {
+	svc := p.client
+	input := &ec2.DescribeSubnetsInput{
+		SubnetIds: []string{subnetID},
+	}
+	req := svc.DescribeSubnetsRequest(input)
+	result, err := req.Send()
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Subnets) == 0 {
+		return nil, fmt.Errorf("subnet %q does not exist", subnetID)
+	}
+	return &result.Subnets[0], nil
+}
+
+// createSecurityGroup creates a run scoped security group that allows ssh in from sshCidr only.
+func (p *AwsProvider) createSecurityGroup(vpcID, runID, sshCidr string) (string, error) {
+	groupName := fmt.Sprintf(AwsProviderInstanceNameFmt, runID)
+	if err := p.record(runID, awsResourceSecurityGroup, groupName); err != nil {
+		return "", err
+	}
+
+	svc := p.client
+	input := &ec2.CreateSecurityGroupInput{
+		GroupName:   aws.String(groupName),
+		Description: aws.String("corebench"),
+		VpcId:       aws.String(vpcID),
+	}
+	req := svc.CreateSecurityGroupRequest(input)
+	result, err := req.Send()
+	if err != nil {
+		return "", err
+	}
+	groupID := aws.StringValue(result.GroupId)
+
+	if err := p.tagResource(groupID, runID); err != nil {
+		return groupID, err
+	}
+
+	ingressInput := &ec2.AuthorizeSecurityGroupIngressInput{
+		GroupId: aws.String(groupID),
+		IpPermissions: []ec2.IpPermission{
+			{
+				IpProtocol: aws.String("tcp"),
+				FromPort:   aws.Int64(22),
+				ToPort:     aws.Int64(22),
+				IpRanges: []ec2.IpRange{
+					{
+						CidrIp: aws.String(sshCidr),
+					},
+				},
+			},
+		},
+	}
+	ingressReq := svc.AuthorizeSecurityGroupIngressRequest(ingressInput)
+	if _, err := ingressReq.Send(); err != nil {
+		return groupID, err
+	}
+
+	log.Infof("Created security group %q", groupID)
+	return groupID, nil
+}
+
+func (p *AwsProvider) deleteSecurityGroup(ctx context.Context, groupID string) error {
+	svc := p.client
+	input := &ec2.DeleteSecurityGroupInput{
+		GroupId: aws.String(groupID),
+	}
+	err := awsDelete(ctx, func() error {
+		_, err := svc.DeleteSecurityGroupRequest(input).Send()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	log.Infof("Deleted security group %q", groupID)
+	return nil
+}
+
+// tagResource applies the corebench tags to a resource created outside of RunInstances.
+func (p *AwsProvider) tagResource(resourceID, runID string) error {
+	svc := p.client
+	input := &ec2.CreateTagsInput{
+		Resources: []string{resourceID},
+		Tags:      awsRunTags(runID),
+	}
+	req := svc.CreateTagsRequest(input)
+	_, err := req.Send()
+	return err
+}
+
+func awsRunTags(runID string) []ec2.Tag {
+	return []ec2.Tag{
+		{
+			Key:   aws.String("Name"),
+			Value: aws.String(fmt.Sprintf(AwsProviderInstanceNameFmt, runID)),
+		},
+		{
+			Key:   aws.String("role"),
+			Value: aws.String("corebench"),
+		},
+		{
+			Key:   aws.String(awsRunTagKey),
+			Value: aws.String(runID),
+		},
+	}
+}
+
+func (p *AwsProvider) runInstance(settings ProviderSpinSettings, spec *awsLaunchSpec, runID, subnetID, groupID string) (string, error) {
+	// The instance id isn't known up front so the instance is found by its run tag on teardown.
+	if err := p.record(runID, awsResourceInstance, runID); err != nil {
+		return "", err
+	}
+
+	svc := p.client
+	input := &ec2.RunInstancesInput{
+		ImageId:      aws.String(spec.ami),
+		InstanceType: ec2.InstanceType(spec.size.InstanceType),
+		KeyName:      aws.String(spec.key.name),
+		MinCount:     aws.Int64(1),
+		MaxCount:     aws.Int64(1),
+		UserData:     aws.String(p.processUserData(settings, spec)),
+		// A shutdown from within the instance, like the max lifetime one, terminates it.
+		InstanceInitiatedShutdownBehavior: ec2.ShutdownBehaviorTerminate,
+		NetworkInterfaces: []ec2.InstanceNetworkInterfaceSpecification{
+			{
+				DeviceIndex:              aws.Int64(0),
+				SubnetId:                 aws.String(subnetID),
+				AssociatePublicIpAddress: aws.Bool(true),
+				DeleteOnTermination:      aws.Bool(true),
+				Groups:                   []string{groupID},
+			},
+		},
+		TagSpecifications: []ec2.TagSpecification{
+			{
+				ResourceType: ec2.ResourceTypeInstance,
+				Tags:         awsRunTags(runID),
+			},
+		},
+	}
+
+	if spot, spotMaxPrice := p.spotSettings(settings); spot {
+		spotOptions := &ec2.SpotMarketOptions{
+			SpotInstanceType:             ec2.SpotInstanceTypeOneTime,
+			InstanceInterruptionBehavior: ec2.InstanceInterruptionBehaviorTerminate,
+		}
+		if spotMaxPrice != "" {
+			spotOptions.MaxPrice = aws.String(spotMaxPrice)
+		}
+		input.InstanceMarketOptions = &ec2.InstanceMarketOptionsRequest{
+			MarketType:  ec2.MarketTypeSpot,
+			SpotOptions: spotOptions,
+		}
+	}
+
+	req := svc.RunInstancesRequest(input)
+	result, err := req.Send()
+	if err != nil {
+		return "", err
+	}
+	if len(result.Instances) == 0 {
+		return "", fmt.Errorf("no instance was launched")
+	}
+
+	instanceID := aws.StringValue(result.Instances[0].InstanceId)
+	log.Infof("Launched instance %q", instanceID)
+	return instanceID, nil
+}
+
+// waitForInstanceIP blocks until the instance is running and has a public ip.
+func (p *AwsProvider) waitForInstanceIP(ctx context.Context, instanceID string) (string, error) {
+	svc := p.client
+	for {
+		input := &ec2.DescribeInstancesInput{
+			InstanceIds: []string{instanceID},
+		}
+		req := svc.DescribeInstancesRequest(input)
+		result, err := req.Send()
+		if err != nil {
+			return "", err
+		}
+		for _, reservation := range result.Reservations {
+			for _, instance := range reservation.Instances {
+				if instance.State == nil {
+					continue
+				}
+				switch instance.State.Name {
+				case ec2.InstanceStateNameRunning:
+					if ip := aws.StringValue(instance.PublicIpAddress); ip != "" {
+						return ip, nil
+					}
+				case ec2.InstanceStateNameShuttingDown, ec2.InstanceStateNameTerminated:
+					return "", fmt.Errorf("instance %q was terminated before it started", instanceID)
+				}
+			}
+		}
+		log.Info("Waiting for instance to start...")
+		if err := utility.Sleep(ctx, 5*time.Second); err != nil {
+			return "", err
+		}
+	}
+}
+
+// terminateInstance terminates the instance and blocks until it's gone, giving up after awsInstanceDeleteTimeout.
+func (p *AwsProvider) terminateInstance(ctx context.Context, instanceID string) error {
+	svc := p.client
+	input := &ec2.TerminateInstancesInput{
+		InstanceIds: []string{instanceID},
+	}
+	err := awsDelete(ctx, func() error {
+		_, err := svc.TerminateInstancesRequest(input).Send()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	log.Infof("Termination request sent for instance %q", instanceID)
+
+	deadline := time.Now().Add(awsInstanceDeleteTimeout)
+	for time.Now().Before(deadline) {
+		input := &ec2.DescribeInstancesInput{
+			InstanceIds: []string{instanceID},
+		}
+		req := svc.DescribeInstancesRequest(input)
+		result, err := req.Send()
+		if err != nil {
+			return err
+		}
+		for _, reservation := range result.Reservations {
+			for _, instance := range reservation.Instances {
+				if instance.State != nil && instance.State.Name == ec2.InstanceStateNameTerminated {
+					return nil
+				}
+			}
+		}
+		if err := utility.Sleep(ctx, 5*time.Second); err != nil {
+			return fmt.Errorf("stopped waiting for instance %q to terminate: %s", instanceID, err)
+		}
+	}
+	return fmt.Errorf("instance %q is still alive %s after terminating it", instanceID, awsInstanceDeleteTimeout)
+}
+
+// spinupInstance launches a single instance into the default vpc, or the user supplied subnet and security group,
+// which is much quicker than standing up a whole cloudformation stack.
+func (p *AwsProvider) spinupInstance(ctx context.Context, settings ProviderSpinSettings, spec *awsLaunchSpec) (*awsInstance, error) {
+	s := awsSpinSettings(settings)
+	runID := spec.runID
+
+	var subnet *ec2.Subnet
+	var err error
+	if s.Subnet != "" {
+		subnet, err = p.lookupSubnet(s.Subnet)
+	} else {
+		subnet, err = p.defaultSubnet(spec.zone)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Only security groups created by corebench are deleted on teardown.
+	groupID := s.SecurityGroup
+	if groupID == "" {
+		groupID, err = p.createSecurityGroup(aws.StringValue(subnet.VpcId), runID, spec.sshCidr)
+		if err != nil {
+			// Teardown finds the group by its tag, so it's deleted here when tagging it failed.
+			if groupID != "" {
+				p.deleteSecurityGroup(ctx, groupID)
+			}
+			return nil, err
+		}
+	}
+
+	instanceID, err := p.runInstance(settings, spec, runID, aws.StringValue(subnet.SubnetId), groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	ip, err := p.waitForInstanceIP(ctx, instanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ssh.PollSSH(ctx, ip+":22"); err != nil {
+		return nil, err
+	}
+
+	return &awsInstance{
+		id: instanceID,
+		ip: ip,
+	}, nil
+}
+
+// termInstances terminates the instances launched directly that match the settings along with their security groups.
+func (p *AwsProvider) termInstances(ctx context.Context, settings ProviderTermSettings) error {
+	svc := p.client
+	input := &ec2.DescribeInstancesInput{
+		Filters: []ec2.Filter{
+			{
+				Name:   aws.String("instance-state-name"),
+				Values: []string{"running", "pending", "stopped"},
+			},
+			{
+				Name:   aws.String("tag-key"),
+				Values: []string{awsRunTagKey},
+			},
+		},
+	}
+	req := svc.DescribeInstancesRequest(input)
+	result, err := req.Send()
+	if err != nil {
+		return err
+	}
+
+	var alive []string
+	for _, reservation := range result.Reservations {
+		for _, instance := range reservation.Instances {
+			instanceID := aws.StringValue(instance.InstanceId)
+			name, runID := awsTagValue(instance.Tags, "Name"), awsTagValue(instance.Tags, awsRunTagKey)
+			if !settings.ShouldTerm(name, aws.StringValue(instance.PublicIpAddress)) {
+				continue
+			}
+
+			log.Infof("Terminating: %s %s against match", instanceID, name)
+			if err := p.terminateInstance(ctx, instanceID); err != nil {
+				log.WithField("id", instanceID).Error("Failed to terminate instance: ", err)
+				alive = append(alive, fmt.Sprintf("%s (%s)", instanceID, name))
+				continue
+			}
+			if err := p.deleteRunSecurityGroups(ctx, runID); err != nil {
+				log.WithField("run", runID).Warning("Failed to delete security group: ", err)
+			}
+			p.deleteInstanceKey(ctx, instance)
+		}
+	}
+
+	if len(alive) > 0 {
+		return fmt.Errorf("instances still alive and billing, delete them manually: %s", strings.Join(alive, ", "))
+	}
+	return nil
+}
+
+// deleteRunSecurityGroups deletes the security groups corebench created for a run.
+func (p *AwsProvider) deleteRunSecurityGroups(ctx context.Context, runID string) error {
+	svc := p.client
+	input := &ec2.DescribeSecurityGroupsInput{
+		Filters: []ec2.Filter{
+			{
+				Name:   aws.String("tag:" + awsRunTagKey),
+				Values: []string{runID},
+			},
+		},
+	}
+	req := svc.DescribeSecurityGroupsRequest(input)
+	result, err := req.Send()
+	if err != nil {
+		return err
+	}
+	for _, group := range result.SecurityGroups {
+		if err := p.deleteSecurityGroup(ctx, aws.StringValue(group.GroupId)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func awsTagValue(tags []ec2.Tag, key string) string {
+	for _, t := range tags {
+		if aws.StringValue(t.Key) == key {
+			return aws.StringValue(t.Value)
+		}
+	}
+	return ""
+}
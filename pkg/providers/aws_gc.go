@@ -0,0 +1,273 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2018 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package providers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/awserr"
+	"github.com/aws/aws-sdk-go-v2/aws/external"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+)
+
+// awsResourceSnapshot is an ebs snapshot tagged as created by corebench, corebench doesn't take snapshots
+// itself but anything made from a benchmark instance is cleaned up along with it.
+const awsResourceSnapshot = "snapshot"
+
+// AwsConfigured reports whether aws credentials are configured.
+func AwsConfigured() bool {
+	_, err := external.LoadDefaultAWSConfig(
+		external.WithSharedConfigProfile("default"))
+	return err == nil
+}
+
+// Resources lists the instances, stacks, security groups, key pairs and snapshots created by corebench.
+func (p *AwsProvider) Resources(ctx context.Context) ([]Resource, error) {
+	var resources []Resource
+	for _, list := range []func() ([]Resource, error){
+		p.instanceResources,
+		p.stackResources,
+		p.securityGroupResources,
+		p.keyPairResources,
+		p.snapshotResources,
+	} {
+		found, err := list()
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, found...)
+	}
+	return resources, nil
+}
+
+// DeleteResource deletes a single resource found by Resources.
+func (p *AwsProvider) DeleteResource(ctx context.Context, r Resource) error {
+	switch r.Kind {
+	case awsResourceInstance:
+		return p.terminateInstance(ctx, r.ID)
+	case awsResourceStack:
+		return p.cleanup(ctx, r.Name)
+	case awsResourceSecurityGroup:
+		return p.deleteSecurityGroup(ctx, r.ID)
+	case awsResourceKeyPair:
+		keyFile, err := runKeyFile(r.Name)
+		if err != nil {
+			return err
+		}
+		p.deleteRunKey(ctx, &awsRunKey{
+			name: r.Name,
+			file: keyFile,
+		})
+		return nil
+	case awsResourceSnapshot:
+		req := p.client.DeleteSnapshotRequest(&ec2.DeleteSnapshotInput{
+			SnapshotId: aws.String(r.ID),
+		})
+		_, err := req.Send()
+		return err
+	}
+	return fmt.Errorf("unknown resource kind %q", r.Kind)
+}
+
+func (p *AwsProvider) newResource(kind, id, name, runID string, created *time.Time) Resource {
+	r := Resource{
+		Provider: "aws",
+		Kind:     kind,
+		ID:       id,
+		Name:     name,
+		RunID:    runID,
+	}
+	if created != nil {
+		r.Created = *created
+	}
+	return r
+}
+
+// awsKeyRunID returns the run id from the name of a run scoped key pair.
+func awsKeyRunID(keyName string) string {
+	return strings.TrimPrefix(keyName, fmt.Sprintf(AwsProviderInstanceNameFmt, ""))
+}
+
+// instanceResources finds the instances launched directly, by their run tag, and by the stack. Every listing
+// is paged through to the end, an orphan on a later page is still billing.
+func (p *AwsProvider) instanceResources() ([]Resource, error) {
+	svc := p.client
+	input := &ec2.DescribeInstancesInput{
+		Filters: []ec2.Filter{
+			{
+				Name:   aws.String("instance-state-name"),
+				Values: []string{"pending", "running", "stopping", "stopped"},
+			},
+		},
+	}
+	var resources []Resource
+	for {
+		req := svc.DescribeInstancesRequest(input)
+		result, err := req.Send()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, reservation := range result.Reservations {
+			for _, instance := range reservation.Instances {
+				runID := awsTagValue(instance.Tags, awsRunTagKey)
+				if runID == "" && awsTagValue(instance.Tags, "aws:cloudformation:stack-name") == awsStackName {
+					runID = awsKeyRunID(aws.StringValue(instance.KeyName))
+				}
+				if runID == "" {
+					continue
+				}
+				resources = append(resources, p.newResource(awsResourceInstance, aws.StringValue(instance.InstanceId),
+					awsTagValue(instance.Tags, "Name"), runID, instance.LaunchTime))
+			}
+		}
+
+		if aws.StringValue(result.NextToken) == "" {
+			break
+		}
+		input.NextToken = result.NextToken
+	}
+	return resources, nil
+}
+
+func (p *AwsProvider) stackResources() ([]Resource, error) {
+	svc := p.cfn
+	input := &cloudformation.DescribeStacksInput{
+		StackName: aws.String(awsStackName),
+	}
+	req := svc.DescribeStacksRequest(input)
+	result, err := req.Send()
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && strings.Contains(aerr.Message(), "does not exist") {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var resources []Resource
+	for _, stack := range result.Stacks {
+		if stack.StackStatus == "DELETE_COMPLETE" || stack.StackStatus == "DELETE_IN_PROGRESS" {
+			continue
+		}
+		var runID string
+		for _, param := range stack.Parameters {
+			if aws.StringValue(param.ParameterKey) == "KeyName" {
+				runID = awsKeyRunID(aws.StringValue(param.ParameterValue))
+			}
+		}
+		resources = append(resources, p.newResource(awsResourceStack, aws.StringValue(stack.StackId),
+			aws.StringValue(stack.StackName), runID, stack.CreationTime))
+	}
+	return resources, nil
+}
+
+func (p *AwsProvider) securityGroupResources() ([]Resource, error) {
+	svc := p.client
+	input := &ec2.DescribeSecurityGroupsInput{
+		Filters: []ec2.Filter{
+			{
+				Name:   aws.String("tag-key"),
+				Values: []string{awsRunTagKey},
+			},
+		},
+	}
+	var resources []Resource
+	for {
+		req := svc.DescribeSecurityGroupsRequest(input)
+		result, err := req.Send()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, group := range result.SecurityGroups {
+			resources = append(resources, p.newResource(awsResourceSecurityGroup, aws.StringValue(group.GroupId),
+				aws.StringValue(group.GroupName), awsTagValue(group.Tags, awsRunTagKey), nil))
+		}
+
+		if aws.StringValue(result.NextToken) == "" {
+			break
+		}
+		input.NextToken = result.NextToken
+	}
+	return resources, nil
+}
+
+func (p *AwsProvider) keyPairResources() ([]Resource, error) {
+	svc := p.client
+	input := &ec2.DescribeKeyPairsInput{
+		Filters: []ec2.Filter{
+			{
+				Name:   aws.String("key-name"),
+				Values: []string{fmt.Sprintf(AwsProviderInstanceNameFmt, "*")},
+			},
+		},
+	}
+	req := svc.DescribeKeyPairsRequest(input)
+	result, err := req.Send()
+	if err != nil {
+		return nil, err
+	}
+
+	var resources []Resource
+	for _, key := range result.KeyPairs {
+		keyName := aws.StringValue(key.KeyName)
+		resources = append(resources, p.newResource(awsResourceKeyPair, keyName, keyName, awsKeyRunID(keyName), nil))
+	}
+	return resources, nil
+}
+
+func (p *AwsProvider) snapshotResources() ([]Resource, error) {
+	svc := p.client
+	input := &ec2.DescribeSnapshotsInput{
+		OwnerIds: []string{"self"},
+		Filters: []ec2.Filter{
+			{
+				Name:   aws.String("tag:role"),
+				Values: []string{"corebench"},
+			},
+		},
+	}
+	var resources []Resource
+	for {
+		req := svc.DescribeSnapshotsRequest(input)
+		result, err := req.Send()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, snapshot := range result.Snapshots {
+			resources = append(resources, p.newResource(awsResourceSnapshot, aws.StringValue(snapshot.SnapshotId),
+				awsTagValue(snapshot.Tags, "Name"), awsTagValue(snapshot.Tags, awsRunTagKey), snapshot.StartTime))
+		}
+
+		if aws.StringValue(result.NextToken) == "" {
+			break
+		}
+		input.NextToken = result.NextToken
+	}
+	return resources, nil
+}
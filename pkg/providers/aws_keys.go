@@ -0,0 +1,131 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2018 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package providers
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/deckarep/corebench/pkg/ssh"
+	"github.com/deckarep/corebench/pkg/utility"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+)
+
+// awsRunKey is a key pair generated locally for a single run, only its public half is imported into aws.
+type awsRunKey struct {
+	name string
+	file string
+}
+
+// runKeyFile returns where the private key of a run scoped key pair is kept.
+func runKeyFile(keyName string) (string, error) {
+	dir, err := utility.ConfigDir("keys")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, keyName+".pem"), nil
+}
+
+// createRunKey generates an ed25519 key pair and imports it under a run scoped name so
+// nobody's existing key pairs are touched.
+func (p *AwsProvider) createRunKey(runID string) (*awsRunKey, error) {
+	keyName := fmt.Sprintf(AwsProviderInstanceNameFmt, runID)
+	if err := p.record(runID, awsResourceKeyPair, keyName); err != nil {
+		return nil, err
+	}
+
+	publicKey, privateKey, err := ssh.GenerateKeyPair(keyName)
+	if err != nil {
+		return nil, err
+	}
+
+	keyFile, err := runKeyFile(keyName)
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(keyFile, privateKey, 0600); err != nil {
+		return nil, err
+	}
+
+	svc := p.client
+	input := &ec2.ImportKeyPairInput{
+		KeyName:           aws.String(keyName),
+		PublicKeyMaterial: publicKey,
+	}
+	req := svc.ImportKeyPairRequest(input)
+	if _, err := req.Send(); err != nil {
+		os.Remove(keyFile)
+		return nil, err
+	}
+
+	log.Infof("Imported key pair %q, private key saved to: %s", keyName, keyFile)
+	return &awsRunKey{
+		name: keyName,
+		file: keyFile,
+	}, nil
+}
+
+// deleteRunKey removes a run scoped key pair from aws along with its private key.
+func (p *AwsProvider) deleteRunKey(ctx context.Context, key *awsRunKey) {
+	svc := p.client
+	input := &ec2.DeleteKeyPairInput{
+		KeyName: aws.String(key.name),
+	}
+	err := awsDelete(ctx, func() error {
+		_, err := svc.DeleteKeyPairRequest(input).Send()
+		return err
+	})
+	if err != nil {
+		log.WithField("key", key.name).Warning("Failed to delete key pair: ", err)
+	} else {
+		log.Infof("Deleted key pair %q", key.name)
+	}
+
+	if err := os.Remove(key.file); err != nil && !os.IsNotExist(err) {
+		log.WithField("file", key.file).Warning("Failed to remove private key: ", err)
+	}
+}
+
+// deleteInstanceKey removes the run scoped key pair an instance was launched with, key pairs
+// not created by corebench are left alone.
+func (p *AwsProvider) deleteInstanceKey(ctx context.Context, instance ec2.Instance) {
+	keyName := aws.StringValue(instance.KeyName)
+	if !strings.HasPrefix(keyName, fmt.Sprintf(AwsProviderInstanceNameFmt, "")) {
+		return
+	}
+	keyFile, err := runKeyFile(keyName)
+	if err != nil {
+		log.Warning("Failed to locate private key: ", err)
+		return
+	}
+	p.deleteRunKey(ctx, &awsRunKey{
+		name: keyName,
+		file: keyFile,
+	})
+}
@@ -24,24 +24,66 @@ package providers
 import (
 	"strconv"
 	"strings"
+	"time"
 )
 
 // TODO: clean up AwsTermSettings-related stuff, nlr
 
 type AwsSpinSettings struct {
-	Benchmem         bool
-	CountFlag        int
-	InstanceType     string
-	Cpu              string
-	Git              string
-	GoVersionFlag    string
-	LeaveRunningFlag bool
-	RegexFlag        string
-	StatFlag         bool
+	AptPackagesFlag    []string
+	BaseFlag           string
+	BenchEstimateFlag  int
+	BenchTimeFlag      string
+	Benchmem           bool
+	CountFlag          int
+	DryRunFlag         bool
+	EnvMatrixFlag      []EnvDimension
+	FileFlag           string
+	ForwardAgentFlag   bool
+	GcFlagsFlag        string
+	GitTokenFlag       string
+	GoPrivateFlag      string
+	InstanceType       string
+	Cpu                string
+	Git                string
+	GoVersionFlag      string
+	LdFlagsFlag        string
+	LeaveRunningFlag   bool
+	OverrideBudgetFlag bool
+	PackagesFlag       []string
+	MaxLifetimeFlag    time.Duration
+	PostBenchFlag      string
+	PreBenchFlag       string
+	RefFlag            string
+	RegexFlag          string
+	RunFlag            string
+	SetupScriptFlag    string
+	SSHCidrFlag        string
+	ShortFlag          bool
+	StatFlag           bool
+	TagsFlag           []string
+	TimeoutFlag        time.Duration
+	VendorFlag         bool
+	// Family is the instance family to pick the smallest instance type from that fits MaxCpu,
+	// when no InstanceType was given.
+	Family string
+	// Zone is the availability zone to deploy into, defaults to the first zone of the region.
+	Zone string
+	// Spot requests the instance on the spot market, optionally capped at SpotMaxPrice $/HR.
+	Spot         bool
+	SpotMaxPrice string
+	// SpotFallback retries the benchmark on-demand when the spot instance is interrupted.
+	SpotFallback bool
+	// Direct launches a single instance with RunInstances instead of creating a cloudformation stack,
+	// into the default vpc unless a Subnet and optionally a SecurityGroup are given.
+	Direct        bool
+	Subnet        string
+	SecurityGroup string
 }
 
-func (aws *AwsSpinSettings) GoVersion() string {
-	return aws.GoVersionFlag
+// GoVersions splits the comma delimited go versions, latest when there are none.
+func (aws *AwsSpinSettings) GoVersions() []string {
+	return splitGoVersions(aws.GoVersionFlag)
 }
 
 func (aws *AwsSpinSettings) InstanceTypeString() string {
@@ -64,8 +106,6 @@ func (aws *AwsSpinSettings) GitURL() string {
 }
 
 func (aws *AwsSpinSettings) Cpus() string {
-	aws.Cpu = "2"
-
 	return aws.Cpu
 }
 
@@ -96,6 +136,106 @@ func (aws *AwsSpinSettings) Stat() bool {
 	return aws.StatFlag
 }
 
+func (aws *AwsSpinSettings) ResultsFile() string {
+	return aws.FileFlag
+}
+
+func (aws *AwsSpinSettings) SSHCidr() string {
+	return aws.SSHCidrFlag
+}
+
+func (aws *AwsSpinSettings) MaxLifetime() time.Duration {
+	return aws.MaxLifetimeFlag
+}
+
+func (aws *AwsSpinSettings) BenchEstimate() int {
+	return aws.BenchEstimateFlag
+}
+
+func (aws *AwsSpinSettings) OverrideBudget() bool {
+	return aws.OverrideBudgetFlag
+}
+
+func (aws *AwsSpinSettings) DryRun() bool {
+	return aws.DryRunFlag
+}
+
+func (aws *AwsSpinSettings) Ref() string {
+	return aws.RefFlag
+}
+
+func (aws *AwsSpinSettings) Base() string {
+	return aws.BaseFlag
+}
+
+func (aws *AwsSpinSettings) Vendor() bool {
+	return aws.VendorFlag
+}
+
+func (aws *AwsSpinSettings) ForwardAgent() bool {
+	return aws.ForwardAgentFlag
+}
+
+func (aws *AwsSpinSettings) GitToken() string {
+	return aws.GitTokenFlag
+}
+
+func (aws *AwsSpinSettings) GoPrivate() string {
+	return aws.GoPrivateFlag
+}
+
+func (aws *AwsSpinSettings) Packages() []string {
+	return aws.PackagesFlag
+}
+
+func (aws *AwsSpinSettings) BenchTime() string {
+	return aws.BenchTimeFlag
+}
+
+func (aws *AwsSpinSettings) Timeout() time.Duration {
+	return aws.TimeoutFlag
+}
+
+func (aws *AwsSpinSettings) Tags() []string {
+	return aws.TagsFlag
+}
+
+func (aws *AwsSpinSettings) Run() string {
+	return aws.RunFlag
+}
+
+func (aws *AwsSpinSettings) Short() bool {
+	return aws.ShortFlag
+}
+
+func (aws *AwsSpinSettings) GcFlags() string {
+	return aws.GcFlagsFlag
+}
+
+func (aws *AwsSpinSettings) LdFlags() string {
+	return aws.LdFlagsFlag
+}
+
+func (aws *AwsSpinSettings) EnvMatrix() []EnvDimension {
+	return aws.EnvMatrixFlag
+}
+
+func (aws *AwsSpinSettings) AptPackages() []string {
+	return aws.AptPackagesFlag
+}
+
+func (aws *AwsSpinSettings) SetupScript() string {
+	return aws.SetupScriptFlag
+}
+
+func (aws *AwsSpinSettings) PreBench() string {
+	return aws.PreBenchFlag
+}
+
+func (aws *AwsSpinSettings) PostBench() string {
+	return aws.PostBenchFlag
+}
+
 type AwsTermSettings struct {
 	AllFlag  bool
 	IPFlag   string
@@ -103,8 +243,25 @@ type AwsTermSettings struct {
 }
 
 func (aws *AwsTermSettings) ShouldTerm(name, ip string) bool {
-	if aws.AllFlag || aws.NameFlag == name || aws.IPFlag == ip {
+	if aws.AllFlag || (aws.NameFlag != "" && aws.NameFlag == name) || (aws.IPFlag != "" && aws.IPFlag == ip) {
 		return true
 	}
 	return false
 }
+
+type AwsSizeSettings struct {
+	FamilyFlag string
+	MinCpuFlag int
+}
+
+func (aws *AwsSizeSettings) ShouldDisplay(instanceType string, vcpus int) bool {
+	if aws.FamilyFlag != "" && instanceFamily(instanceType) != aws.FamilyFlag {
+		return false
+	}
+	return vcpus >= aws.MinCpuFlag
+}
+
+// instanceFamily returns the family of an instance type: c5.xlarge -> c5.
+func instanceFamily(instanceType string) string {
+	return strings.SplitN(instanceType, ".", 2)[0]
+}
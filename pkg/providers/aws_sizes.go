@@ -0,0 +1,430 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2018 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package providers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/pricing"
+)
+
+var (
+	// awsRegionLocations maps region codes to the location names used by the pricing api.
+	awsRegionLocations = map[string]string{
+		"us-east-1":      "US East (N. Virginia)",
+		"us-east-2":      "US East (Ohio)",
+		"us-west-1":      "US West (N. California)",
+		"us-west-2":      "US West (Oregon)",
+		"ca-central-1":   "Canada (Central)",
+		"eu-central-1":   "EU (Frankfurt)",
+		"eu-west-1":      "EU (Ireland)",
+		"eu-west-2":      "EU (London)",
+		"eu-west-3":      "EU (Paris)",
+		"eu-north-1":     "EU (Stockholm)",
+		"ap-south-1":     "Asia Pacific (Mumbai)",
+		"ap-northeast-1": "Asia Pacific (Tokyo)",
+		"ap-northeast-2": "Asia Pacific (Seoul)",
+		"ap-southeast-1": "Asia Pacific (Singapore)",
+		"ap-southeast-2": "Asia Pacific (Sydney)",
+		"sa-east-1":      "South America (Sao Paulo)",
+	}
+)
+
+// awsSize is an ec2 instance type along with its hardware details and on-demand price.
+type awsSize struct {
+	InstanceType   string
+	Vcpus          int
+	Cores          int
+	ThreadsPerCore int
+	MemoryMiB      int64
+	Arch           string
+	GoArch         string
+	PriceHourly    float64
+	SpotHourly     float64
+}
+
+func newAwsSize(it ec2.InstanceTypeInfo) awsSize {
+	sz := awsSize{
+		InstanceType: string(it.InstanceType),
+		GoArch:       "amd64",
+	}
+	if it.VCpuInfo != nil {
+		sz.Vcpus = int(aws.Int64Value(it.VCpuInfo.DefaultVCpus))
+		sz.Cores = int(aws.Int64Value(it.VCpuInfo.DefaultCores))
+		sz.ThreadsPerCore = int(aws.Int64Value(it.VCpuInfo.DefaultThreadsPerCore))
+	}
+	if it.MemoryInfo != nil {
+		sz.MemoryMiB = aws.Int64Value(it.MemoryInfo.SizeInMiB)
+	}
+	if it.ProcessorInfo != nil && len(it.ProcessorInfo.SupportedArchitectures) > 0 {
+		sz.Arch = string(it.ProcessorInfo.SupportedArchitectures[0])
+		if sz.Arch == "arm64" {
+			sz.GoArch = "arm64"
+		}
+	}
+	return sz
+}
+
+// lookupSize describes a single instance type.
+func (p *AwsProvider) lookupSize(instanceType string) (*awsSize, error) {
+	svc := p.client
+	input := &ec2.DescribeInstanceTypesInput{
+		InstanceTypes: []ec2.InstanceType{ec2.InstanceType(instanceType)},
+	}
+	req := svc.DescribeInstanceTypesRequest(input)
+	result, err := req.Send()
+	if err != nil {
+		return nil, err
+	}
+	if len(result.InstanceTypes) == 0 {
+		return nil, fmt.Errorf("instance type %q does not exist in region %q", instanceType, p.region)
+	}
+	sz := newAwsSize(result.InstanceTypes[0])
+	return &sz, nil
+}
+
+// selectSize picks the smallest instance type of the family with enough vcpus for the largest --cpu value.
+func (p *AwsProvider) selectSize(ctx context.Context, family string, maxCpu int) (*awsSize, error) {
+	sizes, err := p.fetchSizes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sizes are sorted by family then vcpus so the first fit is the smallest.
+	for _, sz := range sizes {
+		if instanceFamily(sz.InstanceType) == family && maxCpu <= sz.Vcpus {
+			return &sz, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no %s instance types exist that match a CPU size of %d", family, maxCpu)
+}
+
+func (p *AwsProvider) fetchSizes(ctx context.Context) ([]awsSize, error) {
+	svc := p.client
+	var sizes []awsSize
+	input := &ec2.DescribeInstanceTypesInput{
+		Filters: []ec2.Filter{
+			{
+				Name:   aws.String("current-generation"),
+				Values: []string{"true"},
+			},
+		},
+		MaxResults: aws.Int64(100),
+	}
+	for {
+		req := svc.DescribeInstanceTypesRequest(input)
+		result, err := req.Send()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, it := range result.InstanceTypes {
+			sizes = append(sizes, newAwsSize(it))
+		}
+
+		if result.NextToken == nil {
+			break
+		}
+		input.NextToken = result.NextToken
+	}
+
+	sort.Slice(sizes, func(i, j int) bool {
+		fi, fj := instanceFamily(sizes[i].InstanceType), instanceFamily(sizes[j].InstanceType)
+		if fi != fj {
+			return fi < fj
+		}
+		return sizes[i].Vcpus < sizes[j].Vcpus
+	})
+
+	return sizes, nil
+}
+
+// fetchPrices returns the on-demand linux hourly price of every instance type in the provider's region,
+// or of just the one instance type when it's given.
+func (p *AwsProvider) fetchPrices(ctx context.Context, instanceType string) (map[string]float64, error) {
+	location, ok := awsRegionLocations[p.region]
+	if !ok {
+		return nil, fmt.Errorf("no pricing location is known for region %q", p.region)
+	}
+
+	termMatch := func(field, value string) pricing.Filter {
+		return pricing.Filter{
+			Type:  pricing.FilterTypeTermMatch,
+			Field: aws.String(field),
+			Value: aws.String(value),
+		}
+	}
+
+	svc := p.pricing
+	prices := make(map[string]float64)
+	input := &pricing.GetProductsInput{
+		ServiceCode: aws.String("AmazonEC2"),
+		Filters: []pricing.Filter{
+			termMatch("location", location),
+			termMatch("operatingSystem", "Linux"),
+			termMatch("tenancy", "Shared"),
+			termMatch("preInstalledSw", "NA"),
+			termMatch("capacitystatus", "Used"),
+		},
+		MaxResults: aws.Int64(100),
+	}
+	if instanceType != "" {
+		input.Filters = append(input.Filters, termMatch("instanceType", instanceType))
+	}
+	for {
+		req := svc.GetProductsRequest(input)
+		result, err := req.Send()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range result.PriceList {
+			instanceType, price, ok := parseOnDemandPrice(item)
+			if ok {
+				prices[instanceType] = price
+			}
+		}
+
+		if result.NextToken == nil {
+			break
+		}
+		input.NextToken = result.NextToken
+	}
+
+	return prices, nil
+}
+
+// fetchSpotPrices returns the current cheapest linux spot price across the region's zones for each instance type.
+func (p *AwsProvider) fetchSpotPrices(ctx context.Context, instanceTypes []string) (map[string]float64, error) {
+	svc := p.client
+	prices := make(map[string]float64)
+	input := &ec2.DescribeSpotPriceHistoryInput{
+		ProductDescriptions: []string{"Linux/UNIX"},
+		StartTime:           aws.Time(time.Now()),
+	}
+	for _, it := range instanceTypes {
+		input.InstanceTypes = append(input.InstanceTypes, ec2.InstanceType(it))
+	}
+	for {
+		req := svc.DescribeSpotPriceHistoryRequest(input)
+		result, err := req.Send()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, sp := range result.SpotPriceHistory {
+			price, err := strconv.ParseFloat(aws.StringValue(sp.SpotPrice), 64)
+			if err != nil {
+				continue
+			}
+			instanceType := string(sp.InstanceType)
+			if current, ok := prices[instanceType]; !ok || price < current {
+				prices[instanceType] = price
+			}
+		}
+
+		if aws.StringValue(result.NextToken) == "" {
+			break
+		}
+		input.NextToken = result.NextToken
+	}
+
+	return prices, nil
+}
+
+// parseOnDemandPrice digs the instance type and hourly USD price out of a pricing api product document.
+func parseOnDemandPrice(item aws.JSONValue) (string, float64, bool) {
+	object := func(v interface{}, key string) map[string]interface{} {
+		m, _ := v.(map[string]interface{})
+		child, _ := m[key].(map[string]interface{})
+		return child
+	}
+
+	instanceType, _ := object(object(map[string]interface{}(item), "product"), "attributes")["instanceType"].(string)
+	if instanceType == "" {
+		return "", 0, false
+	}
+
+	// terms.OnDemand.{offer}.priceDimensions.{rate}.pricePerUnit.USD, with a single offer and rate.
+	for _, offer := range object(object(map[string]interface{}(item), "terms"), "OnDemand") {
+		for _, dimension := range object(offer, "priceDimensions") {
+			usd, _ := object(dimension, "pricePerUnit")["USD"].(string)
+			price, err := strconv.ParseFloat(usd, 64)
+			if err != nil {
+				continue
+			}
+			return instanceType, price, true
+		}
+	}
+
+	return "", 0, false
+}
+
+// equivalentSize is the instance type closest to the vcpus and memory of another provider's size along with its
+// on-demand price: the fewest vcpus and then the least memory covering them, the cheapest when several tie.
+// Burstable families are left out, their cpu is throttled once the credits run out mid benchmark.
+func (p *AwsProvider) equivalentSize(ctx context.Context, vcpus int, memoryMiB int64) (*awsSize, error) {
+	sizes, err := p.fetchSizes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []awsSize
+	for _, sz := range sizes {
+		if sz.GoArch == "amd64" && !strings.HasPrefix(instanceFamily(sz.InstanceType), "t") &&
+			sz.Vcpus >= vcpus && sz.MemoryMiB >= memoryMiB {
+			candidates = append(candidates, sz)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no instance type has %d vcpus and %d MiB", vcpus, memoryMiB)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Vcpus != candidates[j].Vcpus {
+			return candidates[i].Vcpus < candidates[j].Vcpus
+		}
+		return candidates[i].MemoryMiB < candidates[j].MemoryMiB
+	})
+
+	var closest *awsSize
+	for i := range candidates {
+		sz := &candidates[i]
+		if sz.Vcpus != candidates[0].Vcpus || sz.MemoryMiB != candidates[0].MemoryMiB {
+			break
+		}
+		prices, err := p.fetchPrices(ctx, sz.InstanceType)
+		if err != nil {
+			return nil, err
+		}
+		sz.PriceHourly = prices[sz.InstanceType]
+		if sz.PriceHourly > 0 && (closest == nil || sz.PriceHourly < closest.PriceHourly) {
+			closest = sz
+		}
+	}
+	if closest == nil {
+		return nil, fmt.Errorf("no price was found for %s", candidates[0].InstanceType)
+	}
+	return closest, nil
+}
+
+func displayAwsSizes(sizes []awsSize) {
+	const padding = 2
+	const typeHdr = "Type"
+	const vcpuHdr = "VCpus"
+	const coresHdr = "Cores"
+	const threadsHdr = "Threads/Core"
+	const mibHdr = "MiB"
+	const archHdr = "Arch"
+	const hourlyRateHdr = "$/HR"
+	const spotRateHdr = "Spot $/HR"
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, padding, '\t', tabwriter.AlignRight)
+	fmt.Fprintln(w, fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t", typeHdr, vcpuHdr, coresHdr, threadsHdr, mibHdr, archHdr, hourlyRateHdr, spotRateHdr))
+	fmt.Fprintln(w, fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t",
+		strings.Repeat("-", len(typeHdr)),
+		strings.Repeat("-", len(vcpuHdr)),
+		strings.Repeat("-", len(coresHdr)),
+		strings.Repeat("-", len(threadsHdr)),
+		strings.Repeat("-", len(mibHdr)),
+		strings.Repeat("-", len(archHdr)),
+		strings.Repeat("-", len(hourlyRateHdr)),
+		strings.Repeat("-", len(spotRateHdr))))
+
+	formatPrice := func(price float64) string {
+		if price > 0 {
+			return fmt.Sprintf("%.4f", price)
+		}
+		return "n/a"
+	}
+
+	for _, sz := range sizes {
+		fmt.Fprintln(w, fmt.Sprintf("%s\t%d\t%d\t%d\t%d\t%s\t%s\t%s\t", sz.InstanceType, sz.Vcpus, sz.Cores, sz.ThreadsPerCore, sz.MemoryMiB, sz.Arch, formatPrice(sz.PriceHourly), formatPrice(sz.SpotHourly)))
+	}
+	w.Flush()
+	fmt.Println()
+}
+
+func (p *AwsProvider) Sizes(ctx context.Context, settings ProviderSizeSettings) error {
+	sizes, err := p.fetchSizes(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch instance types: %s", err)
+	}
+
+	prices, err := p.fetchPrices(ctx, "")
+	if err != nil {
+		return fmt.Errorf("failed to fetch on-demand prices: %s", err)
+	}
+
+	var displayable []awsSize
+	var displayableTypes []string
+	for _, sz := range sizes {
+		if settings.ShouldDisplay(sz.InstanceType, sz.Vcpus) {
+			sz.PriceHourly = prices[sz.InstanceType]
+			displayable = append(displayable, sz)
+			displayableTypes = append(displayableTypes, sz.InstanceType)
+		}
+	}
+
+	spotPrices, err := p.fetchSpotPrices(ctx, displayableTypes)
+	if err != nil {
+		return fmt.Errorf("failed to fetch spot prices: %s", err)
+	}
+	for i := range displayable {
+		displayable[i].SpotHourly = spotPrices[displayable[i].InstanceType]
+	}
+
+	fmt.Println()
+	fmt.Printf("Instance Types (%s):\n", p.region)
+	fmt.Println()
+	displayAwsSizes(displayable)
+
+	log.Infof("(%d) instance types found\n", len(displayable))
+
+	return nil
+}
+
+// priceSize looks up the on-demand and spot prices of a single size, prices that can't be found are left at zero.
+func (p *AwsProvider) priceSize(ctx context.Context, size *awsSize) {
+	prices, err := p.fetchPrices(ctx, size.InstanceType)
+	if err != nil {
+		log.Warn("Failed to fetch on-demand price: ", err)
+	}
+	size.PriceHourly = prices[size.InstanceType]
+
+	spotPrices, err := p.fetchSpotPrices(ctx, []string{size.InstanceType})
+	if err != nil {
+		log.Warn("Failed to fetch spot price: ", err)
+	}
+	size.SpotHourly = spotPrices[size.InstanceType]
+}
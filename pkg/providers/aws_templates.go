@@ -8,15 +8,9 @@ package providers
 
 const (
 AwsProviderInstanceNameFmt = "corebench-aws-%s"
-AwsBenchReadyScript     = "export GOPATH=/home/ubuntu/go && while [ ! -f $GOPATH/.core-init ]; do sleep 1; done"
-AwsBenchCommandTemplate = `cd $GOPATH/src/${git-repo} && /usr/local/go/bin/go get . && /usr/local/go/bin/go version && /usr/local/go/bin/go test -v ${benchmem-setting}-cpu ${cpu-count} -bench=${bench-regex} -count=${bench-count}`
-AwsBenchStatTemplate    = " | tee benchmark.log && echo '\n\n' && $GOPATH/bin/benchstat benchmark.log"
-)
-
-var (
-	awsGoVersionFmt      = "go%s.linux-amd64.tar.gz"
 )
 
+// CfnTemplate is rendered with the templateData of the stack, its bootstrap is escaped for !Sub.
 const CfnTemplate = `
 ---
 AWSTemplateFormatVersion: '2010-09-09'
@@ -24,14 +18,29 @@ Description: ''
 Parameters:
   KeyName:
     Type: AWS::EC2::KeyPair::KeyName
-    Default: ${keypair}
+    Default: {{.Stack.KeyName}}
   ImageId:
     Type: String
-    Default: ami-d944fda6
-  #  Default: ami-d38a4ab1
+    Default: {{.Stack.AMI}}
   InstanceType:
     Type: String
-    Default: ${instancetype}
+    Default: {{.Stack.InstanceType}}
+  MarketType:
+    Type: String
+    Default: {{.Stack.MarketType}}
+    AllowedValues:
+      - spot
+      - on-demand
+  SpotMaxPrice:
+    Type: String
+    Default: '{{.Stack.SpotMaxPrice}}'
+  SSHCidr:
+    Type: String
+    Default: {{.Stack.SSHCidr}}
+
+Conditions:
+  IsSpot: !Equals [!Ref MarketType, spot]
+  HasSpotMaxPrice: !Not [!Equals [!Ref SpotMaxPrice, '']]
 
 Resources:
   VPC:
@@ -46,7 +55,7 @@ Resources:
     Type: AWS::EC2::Subnet
     Properties:
       CidrBlock: 172.17.1.0/24
-      AvailabilityZone: ${awsregion}a
+      AvailabilityZone: {{.Stack.Zone}}
       VpcId: !Ref VPC
 
   SecurityGroup:
@@ -62,7 +71,7 @@ Resources:
       IpProtocol: tcp
       FromPort: 22
       ToPort: 22
-      CidrIp: 0.0.0.0/0
+      CidrIp: !Ref SSHCidr
 
   InboundSGEntry2:
     Type: AWS::EC2::SecurityGroupIngress
@@ -134,9 +143,26 @@ Resources:
       RouteTableId: !Ref RouteTable
       SubnetId: !Ref Subnet1
 
+  LaunchTemplate:
+    Type: AWS::EC2::LaunchTemplate
+    Properties:
+      LaunchTemplateData:
+        InstanceInitiatedShutdownBehavior: terminate
+        InstanceMarketOptions: !If
+          - IsSpot
+          - MarketType: spot
+            SpotOptions:
+              SpotInstanceType: one-time
+              InstanceInterruptionBehavior: terminate
+              MaxPrice: !If [HasSpotMaxPrice, !Ref SpotMaxPrice, !Ref 'AWS::NoValue']
+          - !Ref AWS::NoValue
+
   corebench:
     Type: AWS::EC2::Instance
     Properties:
+      LaunchTemplate:
+        LaunchTemplateId: !Ref LaunchTemplate
+        Version: !GetAtt LaunchTemplate.LatestVersionNumber
       ImageId: !Ref ImageId
       InstanceType: !Ref InstanceType
       KeyName: !Ref KeyName
@@ -157,19 +183,7 @@ Resources:
             curl https://s3.amazonaws.com/cloudformation-examples/aws-cfn-bootstrap-latest.tar.gz | tar xz -C aws-cfn-bootstrap-latest --strip-components 1
             easy_install aws-cfn-bootstrap-latest
 
-            echo "Setting up corebench for the first time..."
-            echo "Installing dependencies..."
-            apt-get -y install git
-            wget https://storage.googleapis.com/golang/${go-version}
-            tar -C /usr/local -xzf ${go-version}
-            export GOROOT=/usr/local/go
-            export GOPATH=/home/ubuntu/go
-            mkdir -p $GOPATH
-            $GOROOT/bin/go get github.com/golang/perf/cmd/benchstat
-            $GOROOT/bin/go get ${git-repo}
-            touch $GOPATH/.core-init
-            chown -R ubuntu:ubuntu $GOPATH
-            echo "Finished corebench initialization"
+            {{indent "            " .Stack.Bootstrap}}
 
             if [ $? != 1 ]; then
               echo "Signalling stack complete"
@@ -187,6 +201,6 @@ Resources:
     CreationPolicy:
       ResourceSignal:
         Count: 1
-        Timeout: PT5M
+        Timeout: {{.Stack.SignalTimeout}}
 
 `
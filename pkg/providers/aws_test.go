@@ -0,0 +1,81 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2018 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package providers
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/deckarep/corebench/pkg/repo"
+	"github.com/deckarep/corebench/pkg/toolchain"
+)
+
+// cfnSignalTimeout finds the creation policy's timeout in a rendered stack template.
+var cfnSignalTimeout = regexp.MustCompile(`(?m)^\s+Timeout: (\S+)$`)
+
+func TestStackSignalTimeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		versions []string
+		settings *AwsSpinSettings
+		want     string
+	}{
+		{"single release", []string{"go1.21.5"}, &AwsSpinSettings{}, "PT5M"},
+		{"tip", []string{toolchain.Tip}, &AwsSpinSettings{}, "PT20M"},
+		{"two toolchains", []string{"go1.21.5", "go1.20.12"}, &AwsSpinSettings{}, "PT25M"},
+		{"four toolchains", []string{"go1.21.5", "go1.20.12", "go1.19.13", "go1.18.10"}, &AwsSpinSettings{}, "PT35M"},
+		{"tip and a release", []string{toolchain.Tip, "go1.21.5"}, &AwsSpinSettings{}, "PT25M"},
+		{"apt packages", []string{"go1.21.5"}, &AwsSpinSettings{AptPackagesFlag: []string{"libpcap-dev"}}, "PT20M"},
+		{"setup script", []string{"go1.21.5"}, &AwsSpinSettings{SetupScriptFlag: "make deps\n"}, "PT20M"},
+	}
+
+	for _, tt := range tests {
+		var tcs []*toolchain.Toolchain
+		for _, version := range tt.versions {
+			tcs = append(tcs, &toolchain.Toolchain{Version: version})
+		}
+		p := &AwsProvider{
+			source:     &repo.Source{ImportPath: "github.com/o/r", Root: "github.com/o/r"},
+			toolchains: tcs,
+		}
+		spec := &awsLaunchSpec{
+			size: &awsSize{InstanceType: "c5.large", GoArch: "amd64"},
+			key:  &awsRunKey{name: "corebench-test"},
+		}
+
+		stack := p.processCfnTemplate(tt.settings, spec)
+		for _, version := range tt.versions {
+			if !strings.Contains(stack, goToolchain{Version: version}.Dir()) {
+				t.Errorf("%s: %s isn't installed by the stack", tt.name, version)
+			}
+		}
+		m := cfnSignalTimeout.FindAllStringSubmatch(stack, -1)
+		if len(m) != 1 {
+			t.Errorf("%s: got %d creation policy timeouts, want 1", tt.name, len(m))
+			continue
+		}
+		if m[0][1] != tt.want {
+			t.Errorf("%s: got timeout %s, want %s", tt.name, m[0][1], tt.want)
+		}
+	}
+}
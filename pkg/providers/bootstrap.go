@@ -0,0 +1,213 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2018 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package providers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/deckarep/corebench/pkg/repo"
+	"github.com/deckarep/corebench/pkg/ssh"
+	"github.com/deckarep/corebench/pkg/toolchain"
+)
+
+// fetchSource puts the source on the instance when the bootstrap couldn't, once it's finished.
+func fetchSource(ctx context.Context, data templateData, settings ProviderSpinSettings, host, identityFile string) error {
+	switch {
+	case data.Source.Local != "":
+		return uploadSource(ctx, data, settings, host, identityFile)
+	case data.Source.Private:
+		return cloneSource(ctx, data, settings, host, identityFile)
+	}
+	return nil
+}
+
+// shellQuote quotes the value so the shell passes it along exactly as it is.
+func shellQuote(value string) string {
+	return "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+}
+
+// uploadSource sends the local directory under test to the instance and fetches its dependencies there.
+func uploadSource(ctx context.Context, data templateData, settings ProviderSpinSettings, host, identityFile string) error {
+	src := data.Source
+	log.Infof("Uploading %s...", src.Local)
+	r, w := io.Pipe()
+	go func() {
+		w.CloseWithError(src.Bundle(w, settings.Vendor()))
+	}()
+	defer r.Close()
+
+	if err := ssh.UploadSSH(ctx, host, identityFile, render("upload", data), r); err != nil {
+		return fmt.Errorf("failed to upload %s: %s", src.Local, err)
+	}
+	return nil
+}
+
+// gitTokenUsers are the user names the code hosts expect alongside an access token.
+var gitTokenUsers = map[string]string{
+	"gitlab.com":    "oauth2",
+	"bitbucket.org": "x-token-auth",
+}
+
+// cloneSource clones a private repository and fetches its dependencies over corebench's ssh session. The
+// credentials only ever travel over that session: the forwarded ssh agent's keys never leave this machine, and
+// a token is read from stdin into a file that's removed once the clone and download are done. Neither ends
+// up in the user data, which anything on the instance can read from the metadata service.
+func cloneSource(ctx context.Context, data templateData, settings ProviderSpinSettings, host, identityFile string) error {
+	log.Infof("Cloning %s over ssh...", data.Source.CloneURL)
+	// The commands run as a script, one per line, so a failure is recorded the same way as in the bootstrap.
+	cmd := render("clone", data)
+
+	var err error
+	if settings.ForwardAgent() {
+		err = forwardAgent(ctx, data, host, identityFile, cmd)
+	} else {
+		err = ssh.UploadSSH(ctx, host, identityFile, cmd, strings.NewReader(settings.GitToken()+"\n"))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to clone %s: %s", data.Source.CloneURL, err)
+	}
+	return nil
+}
+
+// forwardAgent runs the command with the ssh agent forwarded. The instance keeps the host key it generated when
+// it booted, so the private key never leaves it: the key is pinned on the first connection, which waits for the
+// bootstrap without the agent, and the agent is only forwarded to the host holding that key.
+func forwardAgent(ctx context.Context, data templateData, host, identityFile, cmd string) error {
+	knownHosts, err := ssh.NewKnownHosts()
+	if err != nil {
+		return err
+	}
+	defer os.Remove(knownHosts)
+
+	if err := ssh.PinHostSSH(ctx, host, identityFile, knownHosts, render("ready", data), nil); err != nil {
+		return fmt.Errorf("failed waiting for the instance to set up: %s", err)
+	}
+	return ssh.ForwardAgentSSH(ctx, host, identityFile, knownHosts, cmd, nil)
+}
+
+// credentialsKind names how a private repository is cloned, for display, the token itself is never shown.
+func credentialsKind(settings ProviderSpinSettings) string {
+	switch {
+	case settings.ForwardAgent():
+		return "ssh-agent"
+	case settings.GitToken() != "":
+		return "token"
+	}
+	return ""
+}
+
+// resolveSource works out where the repository under test is cloned from and which revision of it is checked out.
+func resolveSource(ctx context.Context, settings ProviderSpinSettings) (*repo.Source, error) {
+	src, err := repo.Resolve(ctx, settings.GitURL())
+	if err != nil {
+		return nil, err
+	}
+	if src.Local != "" && (settings.Ref() != "" || settings.Base() != "") {
+		return nil, fmt.Errorf("a local directory is uploaded as it is, check out the revision to benchmark instead of giving --ref, --head or --base")
+	}
+	if settings.ForwardAgent() || settings.GitToken() != "" {
+		if src.Local != "" {
+			return nil, fmt.Errorf("a local directory is uploaded, it needs neither --forward-agent nor --git-token-env")
+		}
+		if settings.ForwardAgent() {
+			if err := ssh.CheckAgent(); err != nil {
+				return nil, err
+			}
+		}
+		src.Private = true
+	}
+	if settings.Ref() != "" {
+		if err := src.SetRef(settings.Ref()); err != nil {
+			return nil, err
+		}
+	}
+	if settings.Base() != "" {
+		if err := src.SetBase(settings.Base()); err != nil {
+			return nil, err
+		}
+	}
+	return src, nil
+}
+
+// resolveToolchains looks the go versions up before anything is provisioned, a version that doesn't exist
+// fails here rather than in the bootstrap of an instance that's already billing.
+func resolveToolchains(ctx context.Context, settings ProviderSpinSettings) ([]*toolchain.Toolchain, error) {
+	resolver := &toolchain.Resolver{}
+	var tcs []*toolchain.Toolchain
+	given := map[string]string{}
+	for _, version := range settings.GoVersions() {
+		tc, err := resolver.Resolve(ctx, version)
+		if err != nil {
+			return nil, err
+		}
+		if earlier, ok := given[tc.Version]; ok {
+			return nil, fmt.Errorf("--go versions %s and %s are both %s, give each version once", earlier, version, tc.Version)
+		}
+		given[tc.Version] = version
+		if tc.Tip() {
+			log.Infof("Go is built at tip with %s, it adds a few minutes to the bootstrap", tc.Release.Version)
+		} else {
+			log.Infof("Benchmarking with %s", tc.Version)
+		}
+		tcs = append(tcs, tc)
+	}
+	return tcs, nil
+}
+
+// checkArchives fails when a toolchain isn't distributed for the architecture.
+func checkArchives(tcs []*toolchain.Toolchain, goarch string) error {
+	for _, tc := range tcs {
+		if _, err := tc.Archive("linux", goarch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitGoVersions splits the comma delimited --go versions, it's the latest release when there are none.
+func splitGoVersions(flag string) []string {
+	var versions []string
+	for _, version := range strings.Split(flag, ",") {
+		if version = strings.TrimSpace(version); version != "" {
+			versions = append(versions, version)
+		}
+	}
+	if len(versions) == 0 {
+		return []string{toolchain.Latest}
+	}
+	return versions
+}
+
+// toolchainVersions are the resolved versions, for display.
+func toolchainVersions(tcs []*toolchain.Toolchain) []string {
+	var versions []string
+	for _, tc := range tcs {
+		versions = append(versions, tc.Version)
+	}
+	return versions
+}
@@ -0,0 +1,215 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2018 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package providers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/deckarep/corebench/pkg/budget"
+	"github.com/deckarep/corebench/pkg/repo"
+	"github.com/deckarep/corebench/pkg/toolchain"
+)
+
+// benchTime is go test's default -benchtime, every benchmark runs for about this long per cpu value and count.
+const benchTime = time.Second
+
+// tipBuildEstimate is roughly how long building go at tip adds to the bootstrap.
+const tipBuildEstimate = 5 * time.Minute
+
+// costEstimate is what a run is expected to cost before anything is provisioned.
+type costEstimate struct {
+	hourly    float64
+	bootstrap time.Duration
+	bench     time.Duration
+	// benchmarks is how many benchmarks the bench time assumes, counted says whether they were counted in the
+	// source or are --bench-estimate's guess.
+	benchmarks int
+	counted    bool
+	// equivalent is the closest AWS instance type and its price when the run isn't on AWS, nil when it's
+	// unavailable.
+	equivalent *awsSize
+}
+
+// estimateCost estimates the cost of a run from the hourly price, how long the instance takes to bootstrap and
+// how long the benchmarks take: the expected number of benchmarks × --count × cpu values × benchtime.
+func estimateCost(settings ProviderSpinSettings, src *repo.Source, hourly float64, bootstrap time.Duration) costEstimate {
+	benchmarks, counted := benchmarkCount(settings, src)
+	runs := benchmarks * settings.Count() * len(strings.Split(settings.Cpus(), ","))
+	// A comparison benchmarks both revisions.
+	if settings.Base() != "" {
+		runs *= 2
+	}
+	// Every go version and environment runs every benchmark, and tip is built before any of them.
+	runs *= len(settings.GoVersions()) * envCount(settings.EnvMatrix())
+	for _, version := range settings.GoVersions() {
+		if version == toolchain.Tip {
+			bootstrap += tipBuildEstimate
+		}
+	}
+	return costEstimate{
+		hourly:     hourly,
+		bootstrap:  bootstrap,
+		bench:      time.Duration(runs) * runTime(settings.BenchTime()),
+		benchmarks: benchmarks,
+		counted:    counted,
+	}
+}
+
+// benchmarkCount is how many benchmarks the run is expected to have. They're counted when the source is a local
+// directory, a repository isn't cloned until the instance is up so --bench-estimate's guess is used for it.
+func benchmarkCount(settings ProviderSpinSettings, src *repo.Source) (int, bool) {
+	if src != nil && src.Local != "" {
+		n, err := src.Benchmarks(settings.Regex(), settings.Packages())
+		if err == nil {
+			return n, true
+		}
+		log.Warn("Failed to count the benchmarks, estimating with --bench-estimate instead: ", err)
+	}
+	return settings.BenchEstimate(), false
+}
+
+// runTime is roughly how long a benchmark runs for a cpu value and count, a -benchtime given as a number of
+// iterations can't be timed so it's taken to be the default.
+func runTime(benchtime string) time.Duration {
+	if d, err := time.ParseDuration(benchtime); err == nil && d > 0 {
+		return d
+	}
+	return benchTime
+}
+
+func (c costEstimate) total() float64 {
+	return c.hourly * (c.bootstrap + c.bench).Hours()
+}
+
+// benchmarksSource says where the number of benchmarks the estimate assumes comes from.
+func (c costEstimate) benchmarksSource() string {
+	if c.counted {
+		return fmt.Sprintf("%d benchmarks counted in the source", c.benchmarks)
+	}
+	return fmt.Sprintf("a guess of %d benchmarks, set --bench-estimate to how many there are", c.benchmarks)
+}
+
+func (c costEstimate) log() {
+	if c.hourly == 0 {
+		log.Warnf("Hourly price is unavailable, the cost can't be estimated (~%s bootstrap, ~%s benchmarking assuming %s)",
+			c.bootstrap, c.bench, c.benchmarksSource())
+		return
+	}
+	log.Infof("Estimated cost: $%.2f at $%.4f/HR (~%s bootstrap, ~%s benchmarking assuming %s)",
+		c.total(), c.hourly, c.bootstrap, c.bench, c.benchmarksSource())
+	if eq := c.equivalent; eq != nil {
+		log.Infof("AWS equivalent: %s (%d vCPUs, %d MiB) at $%.4f/HR, $%.2f for the same run",
+			eq.InstanceType, eq.Vcpus, eq.MemoryMiB, eq.PriceHourly, eq.PriceHourly*(c.bootstrap+c.bench).Hours())
+	}
+}
+
+// budgetViolations returns every way the run would exceed the budget.
+func budgetViolations(estimate costEstimate) ([]string, error) {
+	config, err := budget.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the budget: %s", err)
+	}
+	spent, err := budget.MonthToDate(time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the run history: %s", err)
+	}
+	return config.Violations(estimate.hourly, estimate.total(), spent), nil
+}
+
+// checkBudget refuses a run that would exceed the budget, unless the budget is overridden.
+func checkBudget(settings ProviderSpinSettings, estimate costEstimate) error {
+	violations, err := budgetViolations(estimate)
+	if err != nil {
+		return err
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	if settings.OverrideBudget() {
+		for _, v := range violations {
+			log.Warn("Overriding the budget: ", v)
+		}
+		return nil
+	}
+	return fmt.Errorf("run exceeds the budget: %s, use --override-budget to run anyway", strings.Join(violations, "; "))
+}
+
+// billing tracks how long an instance has been billed for since it was requested.
+type billing struct {
+	runID        string
+	provider     string
+	instanceType string
+	hourly       float64
+	started      time.Time
+	// leftRunning is set when the instance outlives corebench, it keeps billing after it's reported.
+	leftRunning bool
+}
+
+func newBilling(runID, provider, instanceType string, hourly float64) *billing {
+	return &billing{
+		runID:        runID,
+		provider:     provider,
+		instanceType: instanceType,
+		hourly:       hourly,
+		started:      time.Now(),
+	}
+}
+
+// keep notes that the instance is left running.
+func (b *billing) keep() {
+	if b != nil {
+		b.leftRunning = true
+	}
+}
+
+// report logs the billable time and cost so far, and records them in the results and the run history. They're
+// only known once the benchmarks are done so they're noted after them rather than labelling anything.
+func (b *billing) report(out *results) {
+	if b == nil {
+		return
+	}
+	elapsed := time.Since(b.started).Round(time.Second)
+	cost := b.hourly * elapsed.Hours()
+	log.Infof("Billable time: %s, cost: $%.2f", elapsed, cost)
+	out.Note("corebench-billable-time: %s", elapsed)
+	out.Note("corebench-cost-usd: %.4f", cost)
+	if b.leftRunning {
+		log.Warnf("The instance is left running at $%.4f/HR, only the $%.2f billed until now counts towards the budget", b.hourly, cost)
+	}
+
+	err := budget.Record(budget.Spend{
+		ID:           b.runID,
+		Provider:     b.provider,
+		InstanceType: b.instanceType,
+		Started:      b.started.UTC(),
+		Billable:     elapsed,
+		Cost:         cost,
+		LeftRunning:  b.leftRunning,
+	})
+	if err != nil {
+		log.Warn("Failed to record the run in the history: ", err)
+	}
+}
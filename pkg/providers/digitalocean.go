@@ -31,7 +31,10 @@ import (
 
 	log "github.com/sirupsen/logrus"
 
+	"github.com/deckarep/corebench/pkg/ledger"
+	"github.com/deckarep/corebench/pkg/repo"
 	"github.com/deckarep/corebench/pkg/ssh"
+	"github.com/deckarep/corebench/pkg/toolchain"
 	"github.com/deckarep/corebench/pkg/utility"
 	"github.com/digitalocean/godo"
 	"golang.org/x/oauth2"
@@ -39,29 +42,20 @@ import (
 
 const (
 	doProviderInstanceNameFmt = "corebench-digitalocean-%s"
-	cloudInitTemplate         = `
-#cloud-config
-runcmd:
-  - echo "Setting up corebench for the first time..."
-  - echo "Installing dependencies..."
-  - apt-get -y install git
-  - wget https://storage.googleapis.com/golang/${go-version}
-  - tar -C /usr/local -xzf ${go-version}
-  - export GOROOT=/usr/local/go
-  - export GOPATH=/root/go
-  - mkdir -p $GOPATH
-  - $GOROOT/bin/go get github.com/golang/perf/cmd/benchstat
-  - $GOROOT/bin/go get ${git-repo}
-  - touch $GOPATH/.core-init
-  - echo "Finished corebench initialization"
-`
-	benchReadyScript     = "export GOPATH=/root/go && while [ ! -f $GOPATH/.core-init ]; do sleep 1; done"
-	benchCommandTemplate = `cd $GOPATH/src/${git-repo} && /usr/local/go/bin/go version && /usr/local/go/bin/go test -v ${benchmem-setting}-cpu ${cpu-count} -bench=${bench-regex} -count=${bench-count}`
-	benchStatTemplate    = " | tee benchmark.log && echo '\n\n' && $GOPATH/bin/benchstat benchmark.log"
+	// doUser is who the benchmarks run as, droplets only have root.
+	doUser = "root"
+	// doGoArch is the architecture of every droplet size.
+	doGoArch = "amd64"
+	// doRegion and doImage are where and what every droplet is provisioned with.
+	doRegion = "sfo2"
+	doImage  = "ubuntu-14-04-x64"
+	// doBootstrapEstimate is roughly how long a droplet takes until the benchmarks can start.
+	doBootstrapEstimate = 3 * time.Minute
+	// doAwsEquivalentRegion is the AWS region nearest to doRegion, the droplet's price is compared with it.
+	doAwsEquivalentRegion = "us-west-1"
 )
 
 var (
-	goVersionFmt      = "go%s.linux-amd64.tar.gz"
 	doDefaultPageOpts = &godo.ListOptions{
 		Page:    1,
 		PerPage: 200,
@@ -77,10 +71,14 @@ var (
 )
 
 type DigitalOceanProvider struct {
-	client       *godo.Client
-	repoLastPath string
+	client *godo.Client
+	// source is the repository under test and toolchains the go versions it's benchmarked with, they're resolved
+	// when the run starts.
+	source     *repo.Source
+	toolchains []*toolchain.Toolchain
 	// sshKeys can be optionally used to provision resources so you can log in and inspect the host.
 	sshKeys []string
+	ledger  *ledger.Ledger
 }
 
 func NewDigitalOceanProvider(pat string) Provider {
@@ -95,8 +93,19 @@ func (p *DigitalOceanProvider) SetKeys(keys []string) {
 	p.sshKeys = keys
 }
 
+// droplets lists every droplet tagged corebench, not just the first page of them.
+func (p *DigitalOceanProvider) droplets(ctx context.Context) ([]godo.Droplet, error) {
+	var droplets []godo.Droplet
+	err := doEachPage(ctx, func(opt *godo.ListOptions) (*godo.Response, error) {
+		page, resp, err := p.client.Droplets.ListByTag(ctx, "corebench", opt)
+		droplets = append(droplets, page...)
+		return resp, err
+	})
+	return droplets, err
+}
+
 func (p *DigitalOceanProvider) List(ctx context.Context) error {
-	droplets, _, err := p.client.Droplets.ListByTag(ctx, "corebench", doDefaultPageOpts)
+	droplets, err := p.droplets(ctx)
 	if err != nil {
 		return err
 	}
@@ -216,24 +225,36 @@ func (p *DigitalOceanProvider) fetchSizes(ctx context.Context) (*sizeTypes, erro
 	return &st, nil
 }
 
-func (p *DigitalOceanProvider) Sizes(ctx context.Context) error {
+func (p *DigitalOceanProvider) Sizes(ctx context.Context, settings ProviderSizeSettings) error {
 	st, err := p.fetchSizes(ctx)
 	if err != nil {
 		log.Fatal("Error fetching sizes:", err)
 	}
 
+	displayable := func(sizes []godo.Size) []godo.Size {
+		var results []godo.Size
+		for _, sz := range sizes {
+			if settings.ShouldDisplay(sz.Slug, sz.Vcpus) {
+				results = append(results, sz)
+			}
+		}
+		return results
+	}
+
+	standard, flexible, optimized := displayable(st.standard), displayable(st.flexible), displayable(st.optimized)
+
 	fmt.Println()
-	displaySizes("Standard Droplets:", st.standard)
-	displaySizes("Flexible Droplets:", st.flexible)
-	displaySizes("Optimized Droplets:", st.optimized)
+	displaySizes("Standard Droplets:", standard)
+	displaySizes("Flexible Droplets:", flexible)
+	displaySizes("Optimized Droplets:", optimized)
 
-	log.Infof("(%d) droplet sizes found\n", st.count)
+	log.Infof("(%d) droplet sizes found\n", len(standard)+len(flexible)+len(optimized))
 
 	return nil
 }
 
 func (p *DigitalOceanProvider) Term(ctx context.Context, settings ProviderTermSettings) error {
-	droplets, _, err := p.client.Droplets.ListByTag(ctx, "corebench", doDefaultPageOpts)
+	droplets, err := p.droplets(ctx)
 	if err != nil {
 		return err
 	}
@@ -245,15 +266,29 @@ func (p *DigitalOceanProvider) Term(ctx context.Context, settings ProviderTermSe
 
 	totalCount := len(droplets)
 	termedCount := 0
+	var alive []string
+	now := time.Now()
 	for _, droplet := range droplets {
 		ip, _ := droplet.PublicIPv4()
-		if settings.ShouldTerm(droplet.Name, ip) {
+		matched := settings.ShouldTerm(droplet.Name, ip)
+		if s, ok := settings.(*DoTermSettings); ok && s.ExpiredFlag {
+			matched = dropletExpired(droplet, now)
+		}
+		if matched {
 			log.Infof("Terminating: %d %s %s against match", droplet.ID, droplet.Name, ip)
-			_, err := p.client.Droplets.Delete(ctx, droplet.ID)
-			if err != nil {
-				log.WithField("id", droplet.ID).Warning("Failed to terminate droplet: need to retry or delete it manually or you will billed!!!")
+			if err := p.deleteDroplet(ctx, droplet.ID); err != nil {
+				log.WithField("id", droplet.ID).Error("Failed to terminate droplet: ", err)
+				alive = append(alive, fmt.Sprintf("%d (%s)", droplet.ID, droplet.Name))
 				continue
 			}
+			if err := p.deleteRunFirewall(ctx, droplet.Name); err != nil {
+				log.WithField("firewall", droplet.Name).Warning("Failed to delete firewall: ", err)
+			}
+			for _, tag := range append([]string{droplet.Name}, doExpiryTags(droplet)...) {
+				if err := p.deleteRunTag(ctx, tag); err != nil {
+					log.WithField("tag", tag).Warning("Failed to delete tag: ", err)
+				}
+			}
 			termedCount++
 		}
 	}
@@ -264,46 +299,30 @@ func (p *DigitalOceanProvider) Term(ctx context.Context, settings ProviderTermSe
 		log.Infof("Terminated (%d) droplets out of (%d) total droplets found\n", termedCount, totalCount)
 	}
 
+	if len(alive) > 0 {
+		return fmt.Errorf("droplets still alive and billing, delete them manually: %s", strings.Join(alive, ", "))
+	}
 	return nil
 }
 
-func (p *DigitalOceanProvider) processCloudInitTemplate(settings ProviderSpinSettings) string {
-	p.repoLastPath = utility.GitPathLast(settings.GitURL())
-
-	finalCloudTemplate :=
-		strings.Replace(cloudInitTemplate, "${go-version}", fmt.Sprintf(goVersionFmt, settings.GoVersion()), -1)
-	finalCloudTemplate =
-		strings.Replace(finalCloudTemplate, "${git-repo}", settings.GitURL(), -1)
-	finalCloudTemplate =
-		strings.Replace(finalCloudTemplate, "${git-repo-last-path}", p.repoLastPath, -1)
+// templateData is what the digital ocean templates are rendered with.
+func (p *DigitalOceanProvider) templateData(settings ProviderSpinSettings) templateData {
+	data := newTemplateData(settings, p.source, p.toolchains, doUser, doGoArch)
+	return data
+}
 
-	return finalCloudTemplate
+func (p *DigitalOceanProvider) processUserDataTemplate(settings ProviderSpinSettings) string {
+	return render("user-data", p.templateData(settings))
 }
 
 func (p *DigitalOceanProvider) processBenchCommandTemplate(settings ProviderSpinSettings) string {
-	benchCmd :=
-		strings.Replace(benchCommandTemplate, "${git-repo}", settings.GitURL(), -1)
-	benchCmd =
-		strings.Replace(benchCmd, "${cpu-count}", settings.Cpus(), -1)
-	benchCmd =
-		strings.Replace(benchCmd, "${benchmem-setting}", settings.BenchMemString(), -1)
-	benchCmd =
-		strings.Replace(benchCmd, "${bench-regex}", settings.Regex(), -1)
-	benchCmd =
-		strings.Replace(benchCmd, "${bench-count}", fmt.Sprintf("%d", settings.Count()), -1)
-
-	// Should be last, turns on the benchstat summary
-	if settings.Stat() {
-		benchCmd = benchCmd + benchStatTemplate
-	}
-
-	return fmt.Sprintf("%s && %s", benchReadyScript, benchCmd)
+	return render("bench", p.templateData(settings))
 }
 
-func (p *DigitalOceanProvider) selectDroplet(ctx context.Context, settings ProviderSpinSettings) godo.Size {
+func (p *DigitalOceanProvider) selectDroplet(ctx context.Context, settings ProviderSpinSettings) (godo.Size, error) {
 	sizes, err := p.fetchSizes(ctx)
 	if err != nil {
-		log.Fatal("Failed to fetch Droplet sizes with err:", err.Error())
+		return godo.Size{}, fmt.Errorf("failed to fetch droplet sizes with err: %s", err)
 	}
 
 	maxCPUSize := settings.MaxCpu()
@@ -316,27 +335,111 @@ func (p *DigitalOceanProvider) selectDroplet(ctx context.Context, settings Provi
 	}
 
 	if selectedSize.Vcpus == 0 {
-		log.Fatalf("No droplets exist that match a CPU size of %d", maxCPUSize)
+		return godo.Size{}, fmt.Errorf("no droplets exist that match a CPU size of %d", maxCPUSize)
 	}
 
-	return selectedSize
+	return selectedSize, nil
 }
 
-func (p *DigitalOceanProvider) Spinup(ctx context.Context, settings ProviderSpinSettings) error {
+func (p *DigitalOceanProvider) Spinup(ctx context.Context, settings ProviderSpinSettings) (err error) {
+	selectedSize, err := p.selectDroplet(ctx, settings)
+	if err != nil {
+		return err
+	}
+
+	sshCidr, err := utility.CallerCIDR(settings.SSHCidr())
+	if err != nil {
+		return err
+	}
 
-	//log.Fatal(p.processCloudInitTemplate(settings))
-	//log.Fatal(p.processBenchCommandTemplate(settings))
-	selectedSize := p.selectDroplet(ctx, settings)
+	if p.source, err = resolveSource(ctx, settings); err != nil {
+		return err
+	}
+	if p.toolchains, err = resolveToolchains(ctx, settings); err != nil {
+		return err
+	}
+	if err := checkArchives(p.toolchains, doGoArch); err != nil {
+		return err
+	}
+
+	estimate := estimateCost(settings, p.source, selectedSize.PriceHourly, doBootstrapEstimate)
+	estimate.equivalent = awsEquivalent(ctx, selectedSize)
+	if settings.DryRun() {
+		plan := &dryRunPlan{
+			Provider:     "digitalocean",
+			Region:       doRegion,
+			InstanceType: selectedSize.Slug,
+			Vcpus:        selectedSize.Vcpus,
+			GoArch:       doGoArch,
+			Image:        doImage,
+			Market:       "on-demand",
+			SSHCidr:      sshCidr,
+			MaxLifetime:  settings.MaxLifetime().String(),
+			GoVersions:   toolchainVersions(p.toolchains),
+			Repository:   p.source.Origin(),
+			Ref:          p.source.Ref,
+			Base:         p.source.Base,
+			Credentials:  credentialsKind(settings),
+			Template:     p.processUserDataTemplate(settings),
+			BenchCommand: p.processBenchCommandTemplate(settings),
+		}
+		return plan.print(estimate)
+	}
 
 	fmt.Printf("About to provision Droplet slug size: %s with cpu count of: %d?\n", selectedSize.Slug, selectedSize.Vcpus)
+	log.Infof("SSH access will be restricted to %s", sshCidr)
+	if lifetime := settings.MaxLifetime(); lifetime > 0 {
+		log.Infof("Droplet will power itself off after %s and is deleted by \"corebench do term --expired\"", lifetime)
+	}
+	estimate.log()
+	if err := checkBudget(settings, estimate); err != nil {
+		return err
+	}
 	if !utility.PromptConfirmation("Continue provisioning? (Yy)es/(Nn)o") {
 		log.Info("Quiting")
 		return nil
 	}
 
+	book, err := ledger.Open()
+	if err != nil {
+		return err
+	}
+	p.ledger = book
+
+	out, err := newResults(settings.ResultsFile())
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	// The run name doubles as the tag the firewall applies to, so only this droplet is covered by it.
+	runName := fmt.Sprintf(doProviderInstanceNameFmt, utility.NewInstanceID())
+
+	// Everything created from here on is recorded in the ledger and torn down on the way out,
+	// whether the benchmark completes, fails or is interrupted.
+	var chosenIP string
+	var bill *billing
+	defer func() {
+		if settings.LeaveRunning() && chosenIP != "" && ctx.Err() == nil {
+			p.ledger.Keep(runName)
+			log.Infof("Leaving droplet %s running at ip: %s", runName, chosenIP)
+			bill.keep()
+			bill.report(out)
+			return
+		}
+		if terr := teardownRun(p, p.ledger, runName); terr != nil && err == nil {
+			err = terr
+		}
+		bill.report(out)
+	}()
+
+	if err := p.createRunFirewall(ctx, runName, sshCidr); err != nil {
+		return fmt.Errorf("failed to create firewall with err: %s", err)
+	}
+
 	createRequest := &godo.DropletCreateRequest{
-		Name:   fmt.Sprintf(doProviderInstanceNameFmt, utility.NewInstanceID()),
-		Region: "sfo2",
+		Name:   runName,
+		Region: doRegion,
 		Size:   selectedSize.Slug,
 		// Costs: .01 penny to turn on (test with this)
 		//Region: "sfo2",
@@ -344,11 +447,11 @@ func (p *DigitalOceanProvider) Spinup(ctx context.Context, settings ProviderSpin
 		// Costs: .71 cents just to turn this beyatch on.
 		//Region: "nyc1",
 		//Size:   "c-16",
-		Tags: []string{"corebench"},
+		Tags: []string{"corebench", runName},
 		Image: godo.DropletCreateImage{
-			Slug: "ubuntu-14-04-x64",
+			Slug: doImage,
 		},
-		UserData: p.processCloudInitTemplate(settings),
+		UserData: p.processUserDataTemplate(settings),
 	}
 
 	if len(p.sshKeys) > 0 {
@@ -362,78 +465,100 @@ func (p *DigitalOceanProvider) Spinup(ctx context.Context, settings ProviderSpin
 		createRequest.SSHKeys = dropKeys
 	}
 
+	// A powered off droplet is still billed so the expiry is also tagged for term --expired to act on.
+	if lifetime := settings.MaxLifetime(); lifetime > 0 {
+		expiryTag := doExpiryTag(time.Now().Add(lifetime))
+		if err := p.record(runName, doResourceTag, expiryTag); err != nil {
+			return err
+		}
+		createRequest.Tags = append(createRequest.Tags, expiryTag)
+	}
+
+	// The droplet id isn't known up front so the droplet is found by its run tag on teardown.
+	if err := p.record(runName, doResourceDroplet, runName); err != nil {
+		return err
+	}
+	bill = newBilling(runName, "digitalocean", selectedSize.Slug, selectedSize.PriceHourly)
 	newDroplet, _, err := p.client.Droplets.Create(ctx, createRequest)
 	if err != nil {
-		log.Error("Failed to create droplet with err: %s\n", err)
-		return err
+		return fmt.Errorf("failed to create droplet with err: %s", err)
 	}
 
 	log.Infof("Provisioning Droplet: %s ...", newDroplet.Name)
 	log.Info("Slug: ", createRequest.Size)
 	log.Info("Region: ", createRequest.Region)
 
-	// fmt.Println(newDroplet.Name)
-	// fmt.Println(newDroplet.ID)
-	// fmt.Println(newDroplet.PublicIPv4())
-
-	// Capture the droplets by id because we should delete at the end.
-	// TODO: retry the deletes
-	// TODO: recover panics and ensure the delete operation happens.
-	var allDropletIds []int
-	if !settings.LeaveRunning() {
-		defer func() {
-			p.cleanup(ctx, allDropletIds)
-		}()
-	}
-
-	var chosenIP string
-	const maxDialAttempts = 20
-
 	// Spin wait - TODO: make this more graceful.
 advance_to_ssh:
 	for {
-		droplets, _, err := p.client.Droplets.ListByTag(ctx, "corebench", doDefaultPageOpts)
+		droplets, _, err := p.client.Droplets.ListByTag(ctx, runName, doDefaultPageOpts)
 		if err != nil {
-			log.Fatal("Couldn't list all droplets with err: ", err)
+			return fmt.Errorf("couldn't list droplets with err: %s", err)
 		}
 
-		// reset the ids on each outer iteration otherwise the list just grows.
-		allDropletIds = nil
 		for _, d := range droplets {
-			allDropletIds = append(allDropletIds, d.ID)
 			ip, _ := d.PublicIPv4()
-			//fmt.Println(d.Name, d.ID, ip)
 			// if we have an ip, start attempting...
 			if ip != "" {
-				chosenIP = ip
-				err = ssh.PollSSH(chosenIP + ":22")
-				if err == nil {
-					//println("ssh dial success continuing!")
-					break advance_to_ssh
+				if err := ssh.PollSSH(ctx, ip+":22"); err != nil {
+					return err
 				}
+				chosenIP = ip
+				break advance_to_ssh
 			}
 		}
-		time.Sleep(time.Second * 3)
+		if err := utility.Sleep(ctx, time.Second*3); err != nil {
+			return err
+		}
 	}
 
 	log.Info("Droplet is provisioned and reachable at ip:", chosenIP)
 	log.Info("Droplet benchmark starting momentarily...")
 	fmt.Println()
 	benchCmd := p.processBenchCommandTemplate(settings)
-	err = ssh.ExecuteSSH(chosenIP, benchCmd)
+
+	if err := fetchSource(ctx, p.templateData(settings), settings, chosenIP, ""); err != nil {
+		return err
+	}
+
+	out.Label("corebench-provider", "digitalocean")
+	out.Label("corebench-instance-type", selectedSize.Slug)
+	out.Label("goarch", doGoArch)
+	if p.source.Ref != "" {
+		out.Label("corebench-ref", p.source.Ref)
+	}
+	if p.source.Base != "" {
+		out.Label("corebench-base", p.source.Base)
+	}
+	out.Label("corebench-estimated-cost-usd", fmt.Sprintf("%.4f", estimate.total()))
+
+	err = ssh.ExecuteSSH(ctx, chosenIP, "", benchCmd, out)
 	if err != nil {
-		log.Fatalln("Failed to SSH: ", err)
+		return fmt.Errorf("failed to SSH: %s", err)
 	}
 
 	return nil
 }
 
-func (p *DigitalOceanProvider) cleanup(ctx context.Context, ids []int) {
-	for _, id := range ids {
-		log.Info("Cleaning up droplet:", id)
-		_, err := p.client.Droplets.Delete(ctx, id)
-		if err != nil {
-			log.Fatal("Failed to delete droplet: need to retry or delete it manually or you will billed!!!", id)
+// awsEquivalent is the AWS instance type closest to the droplet size, priced, or nil when AWS can't be asked which
+// is usually for lack of AWS credentials.
+func awsEquivalent(ctx context.Context, size godo.Size) *awsSize {
+	pricer, err := newAwsProvider(doAwsEquivalentRegion)
+	if err == nil {
+		var eq *awsSize
+		if eq, err = pricer.equivalentSize(ctx, size.Vcpus, int64(size.Memory)); err == nil {
+			return eq
 		}
 	}
+	log.Info("AWS equivalent price is unavailable: ", err)
+	return nil
+}
+
+// record notes a resource of the run in the ledger, it must be called before the resource is created.
+func (p *DigitalOceanProvider) record(runName, kind, name string) error {
+	run := ledger.Run{
+		ID:       runName,
+		Provider: "digitalocean",
+	}
+	return p.ledger.Record(run, ledger.Resource{Kind: kind, Name: name})
 }
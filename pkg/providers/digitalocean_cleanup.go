@@ -0,0 +1,175 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2018 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/deckarep/corebench/pkg/ledger"
+	"github.com/deckarep/corebench/pkg/utility"
+	"github.com/digitalocean/godo"
+)
+
+const (
+	// doDeleteAttempts is how many times a delete is tried before giving up on it.
+	doDeleteAttempts = 6
+	// doDeleteTimeout is how long a deleted droplet may take to really disappear.
+	doDeleteTimeout = 5 * time.Minute
+)
+
+// doExpiryTagPrefix prefixes the tag holding the unix time a droplet's max lifetime is up.
+const doExpiryTagPrefix = "corebench-expires-"
+
+// The kinds of digitalocean resources recorded in the ledger.
+const (
+	doResourceTag      = "tag"
+	doResourceFirewall = "firewall"
+	doResourceDroplet  = "droplet"
+)
+
+// Cleanup tears down the resources recorded for a run, resources that no longer exist are skipped.
+func (p *DigitalOceanProvider) Cleanup(ctx context.Context, run ledger.Run) error {
+	// Resources are torn down in the reverse order they were created so nothing is still in use.
+	for i := len(run.Resources) - 1; i >= 0; i-- {
+		resource := run.Resources[i]
+		var err error
+		switch resource.Kind {
+		case doResourceDroplet:
+			err = p.deleteRunDroplets(ctx, resource.Name)
+		case doResourceFirewall:
+			err = p.deleteRunFirewall(ctx, resource.Name)
+		case doResourceTag:
+			err = p.deleteRunTag(ctx, resource.Name)
+		default:
+			log.WithField("kind", resource.Kind).Warning("Skipping unknown resource kind")
+		}
+		if err != nil {
+			return fmt.Errorf("failed to delete %s %q: %s", resource.Kind, resource.Name, err)
+		}
+	}
+	return nil
+}
+
+// deleteRunDroplets deletes the droplets tagged with the run.
+func (p *DigitalOceanProvider) deleteRunDroplets(ctx context.Context, runName string) error {
+	droplets, _, err := p.client.Droplets.ListByTag(ctx, runName, doDefaultPageOpts)
+	if err != nil {
+		if doNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	var alive []string
+	for _, d := range droplets {
+		log.Info("Cleaning up droplet:", d.ID)
+		if err := p.deleteDroplet(ctx, d.ID); err != nil {
+			log.WithField("id", d.ID).Error(err)
+			alive = append(alive, strconv.Itoa(d.ID))
+		}
+	}
+	if len(alive) > 0 {
+		return fmt.Errorf("droplets %s are still alive", strings.Join(alive, ", "))
+	}
+	return nil
+}
+
+// deleteDroplet deletes the droplet and waits until it's really gone.
+func (p *DigitalOceanProvider) deleteDroplet(ctx context.Context, id int) error {
+	err := doDelete(ctx, func() (*godo.Response, error) {
+		return p.client.Droplets.Delete(ctx, id)
+	})
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(doDeleteTimeout)
+	for time.Now().Before(deadline) {
+		if _, _, err := p.client.Droplets.Get(ctx, id); doNotFound(err) {
+			return nil
+		}
+		if err := utility.Sleep(ctx, 5*time.Second); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("droplet %d is still alive %s after deleting it", id, doDeleteTimeout)
+}
+
+// doDelete retries a delete that failed, waiting out the rate limit when it's been hit. Client errors other than
+// rate limiting aren't retried, and not found counts as deleted.
+func doDelete(ctx context.Context, call func() (*godo.Response, error)) error {
+	return utility.Retry(ctx, doDeleteAttempts, func() error {
+		resp, err := call()
+		if err == nil || doNotFound(err) {
+			return nil
+		}
+		if resp != nil && resp.Response != nil {
+			switch {
+			case resp.StatusCode == http.StatusTooManyRequests:
+				return utility.RetryAfter(err, time.Until(resp.Rate.Reset.Time))
+			case resp.StatusCode >= 400 && resp.StatusCode < 500:
+				return utility.Permanent(err)
+			}
+		}
+		return err
+	})
+}
+
+// doNotFound reports whether the api responded that the resource doesn't exist.
+func doNotFound(err error) bool {
+	if errResp, ok := err.(*godo.ErrorResponse); ok && errResp.Response != nil {
+		return errResp.Response.StatusCode == http.StatusNotFound
+	}
+	return false
+}
+
+func doExpiryTag(expires time.Time) string {
+	return fmt.Sprintf("%s%d", doExpiryTagPrefix, expires.Unix())
+}
+
+func doExpiryTags(droplet godo.Droplet) []string {
+	var tags []string
+	for _, tag := range droplet.Tags {
+		if strings.HasPrefix(tag, doExpiryTagPrefix) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// dropletExpired reports whether the droplet has outlived the max lifetime it was created with.
+func dropletExpired(droplet godo.Droplet, now time.Time) bool {
+	for _, tag := range doExpiryTags(droplet) {
+		expires, err := strconv.ParseInt(strings.TrimPrefix(tag, doExpiryTagPrefix), 10, 64)
+		if err == nil && now.Unix() >= expires {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2018 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package providers
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/digitalocean/godo"
+)
+
+// createRunFirewall creates a tag named after the run along with a firewall applied to that tag which only
+// allows ssh in from sshCidr, any droplet created with the tag is covered by the firewall.
+func (p *DigitalOceanProvider) createRunFirewall(ctx context.Context, runName, sshCidr string) error {
+	if err := p.record(runName, doResourceTag, runName); err != nil {
+		return err
+	}
+	if _, _, err := p.client.Tags.Create(ctx, &godo.TagCreateRequest{Name: runName}); err != nil {
+		return err
+	}
+
+	anywhere := &godo.Destinations{Addresses: []string{"0.0.0.0/0", "::/0"}}
+	request := &godo.FirewallRequest{
+		Name: runName,
+		InboundRules: []godo.InboundRule{
+			{
+				Protocol:  "tcp",
+				PortRange: "22",
+				Sources:   &godo.Sources{Addresses: []string{sshCidr}},
+			},
+		},
+		OutboundRules: []godo.OutboundRule{
+			{Protocol: "tcp", PortRange: "all", Destinations: anywhere},
+			{Protocol: "udp", PortRange: "all", Destinations: anywhere},
+			{Protocol: "icmp", Destinations: anywhere},
+		},
+		Tags: []string{runName},
+	}
+	if err := p.record(runName, doResourceFirewall, runName); err != nil {
+		return err
+	}
+	_, _, err := p.client.Firewalls.Create(ctx, request)
+	return err
+}
+
+// deleteRunFirewall deletes the firewall created for a run, the run's droplet should be deleted first.
+func (p *DigitalOceanProvider) deleteRunFirewall(ctx context.Context, runName string) error {
+	var firewalls []godo.Firewall
+	err := doEachPage(ctx, func(opt *godo.ListOptions) (*godo.Response, error) {
+		page, resp, err := p.client.Firewalls.List(ctx, opt)
+		firewalls = append(firewalls, page...)
+		return resp, err
+	})
+	if err != nil {
+		return err
+	}
+	for _, fw := range firewalls {
+		if fw.Name != runName {
+			continue
+		}
+		log.Info("Cleaning up firewall:", fw.Name)
+		id := fw.ID
+		err := doDelete(ctx, func() (*godo.Response, error) {
+			return p.client.Firewalls.Delete(ctx, id)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteRunTag deletes the tag created for a run.
+func (p *DigitalOceanProvider) deleteRunTag(ctx context.Context, runName string) error {
+	return doDelete(ctx, func() (*godo.Response, error) {
+		return p.client.Tags.Delete(ctx, runName)
+	})
+}
@@ -0,0 +1,135 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2018 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package providers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/digitalocean/godo"
+)
+
+// doResourceSnapshot is a droplet snapshot named like a corebench droplet, corebench doesn't take snapshots
+// itself but anything made from a benchmark droplet is cleaned up along with it.
+const doResourceSnapshot = "snapshot"
+
+// Resources lists the droplets, firewalls and snapshots created by corebench.
+func (p *DigitalOceanProvider) Resources(ctx context.Context) ([]Resource, error) {
+	var resources []Resource
+	runPrefix := fmt.Sprintf(doProviderInstanceNameFmt, "")
+
+	err := doEachPage(ctx, func(opt *godo.ListOptions) (*godo.Response, error) {
+		droplets, resp, err := p.client.Droplets.ListByTag(ctx, "corebench", opt)
+		for _, d := range droplets {
+			resources = append(resources, newDoResource(doResourceDroplet, strconv.Itoa(d.ID), d.Name, d.Created))
+		}
+		return resp, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = doEachPage(ctx, func(opt *godo.ListOptions) (*godo.Response, error) {
+		firewalls, resp, err := p.client.Firewalls.List(ctx, opt)
+		for _, fw := range firewalls {
+			if strings.HasPrefix(fw.Name, runPrefix) {
+				resources = append(resources, newDoResource(doResourceFirewall, fw.ID, fw.Name, fw.Created))
+			}
+		}
+		return resp, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = doEachPage(ctx, func(opt *godo.ListOptions) (*godo.Response, error) {
+		snapshots, resp, err := p.client.Snapshots.ListDroplet(ctx, opt)
+		for _, s := range snapshots {
+			if strings.HasPrefix(s.Name, runPrefix) {
+				resources = append(resources, newDoResource(doResourceSnapshot, s.ID, s.Name, s.Created))
+			}
+		}
+		return resp, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resources, nil
+}
+
+// DeleteResource deletes a single resource found by Resources.
+func (p *DigitalOceanProvider) DeleteResource(ctx context.Context, r Resource) error {
+	switch r.Kind {
+	case doResourceDroplet:
+		id, err := strconv.Atoi(r.ID)
+		if err != nil {
+			return err
+		}
+		return p.deleteDroplet(ctx, id)
+	case doResourceFirewall:
+		return doDelete(ctx, func() (*godo.Response, error) {
+			return p.client.Firewalls.Delete(ctx, r.ID)
+		})
+	case doResourceSnapshot:
+		return doDelete(ctx, func() (*godo.Response, error) {
+			return p.client.Snapshots.Delete(ctx, r.ID)
+		})
+	}
+	return fmt.Errorf("unknown resource kind %q", r.Kind)
+}
+
+// doEachPage calls list with every page of a listing in turn, godo only returns the page that's asked for.
+func doEachPage(ctx context.Context, list func(opt *godo.ListOptions) (*godo.Response, error)) error {
+	opt := &godo.ListOptions{Page: 1, PerPage: doDefaultPageOpts.PerPage}
+	for {
+		resp, err := list(opt)
+		if err != nil {
+			return err
+		}
+		if resp == nil || resp.Links == nil || resp.Links.IsLastPage() {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		opt.Page++
+	}
+}
+
+// newDoResource names the run after the droplet, which is also what the ledger keeps it under.
+func newDoResource(kind, id, name, created string) Resource {
+	r := Resource{
+		Provider: "digitalocean",
+		Kind:     kind,
+		ID:       id,
+		Name:     name,
+		RunID:    name,
+	}
+	if t, err := time.Parse(time.RFC3339, created); err == nil {
+		r.Created = t
+	}
+	return r
+}
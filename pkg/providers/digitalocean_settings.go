@@ -24,22 +24,49 @@ package providers
 import (
 	"strconv"
 	"strings"
+	"time"
 )
 
 type DoSpinSettings struct {
-	Benchmem         bool
-	CountFlag        int
-	InstanceType     string
-	Cpu              string
-	Git              string
-	GoVersionFlag    string
-	LeaveRunningFlag bool
-	RegexFlag        string
-	StatFlag         bool
+	AptPackagesFlag    []string
+	BaseFlag           string
+	BenchEstimateFlag  int
+	BenchTimeFlag      string
+	Benchmem           bool
+	CountFlag          int
+	DryRunFlag         bool
+	EnvMatrixFlag      []EnvDimension
+	FileFlag           string
+	ForwardAgentFlag   bool
+	GcFlagsFlag        string
+	GitTokenFlag       string
+	GoPrivateFlag      string
+	InstanceType       string
+	Cpu                string
+	Git                string
+	GoVersionFlag      string
+	LdFlagsFlag        string
+	LeaveRunningFlag   bool
+	OverrideBudgetFlag bool
+	PackagesFlag       []string
+	MaxLifetimeFlag    time.Duration
+	PostBenchFlag      string
+	PreBenchFlag       string
+	RefFlag            string
+	RegexFlag          string
+	RunFlag            string
+	SetupScriptFlag    string
+	SSHCidrFlag        string
+	ShortFlag          bool
+	StatFlag           bool
+	TagsFlag           []string
+	TimeoutFlag        time.Duration
+	VendorFlag         bool
 }
 
-func (do *DoSpinSettings) GoVersion() string {
-	return do.GoVersionFlag
+// GoVersions splits the comma delimited go versions, latest when there are none.
+func (do *DoSpinSettings) GoVersions() []string {
+	return splitGoVersions(do.GoVersionFlag)
 }
 
 func (do *DoSpinSettings) InstanceTypeString() string {
@@ -93,15 +120,124 @@ func (do *DoSpinSettings) Stat() bool {
 	return do.StatFlag
 }
 
+func (do *DoSpinSettings) ResultsFile() string {
+	return do.FileFlag
+}
+
+func (do *DoSpinSettings) SSHCidr() string {
+	return do.SSHCidrFlag
+}
+
+func (do *DoSpinSettings) MaxLifetime() time.Duration {
+	return do.MaxLifetimeFlag
+}
+
+func (do *DoSpinSettings) BenchEstimate() int {
+	return do.BenchEstimateFlag
+}
+
+func (do *DoSpinSettings) OverrideBudget() bool {
+	return do.OverrideBudgetFlag
+}
+
+func (do *DoSpinSettings) DryRun() bool {
+	return do.DryRunFlag
+}
+
+func (do *DoSpinSettings) Ref() string {
+	return do.RefFlag
+}
+
+func (do *DoSpinSettings) Base() string {
+	return do.BaseFlag
+}
+
+func (do *DoSpinSettings) Vendor() bool {
+	return do.VendorFlag
+}
+
+func (do *DoSpinSettings) ForwardAgent() bool {
+	return do.ForwardAgentFlag
+}
+
+func (do *DoSpinSettings) GitToken() string {
+	return do.GitTokenFlag
+}
+
+func (do *DoSpinSettings) GoPrivate() string {
+	return do.GoPrivateFlag
+}
+
+func (do *DoSpinSettings) Packages() []string {
+	return do.PackagesFlag
+}
+
+func (do *DoSpinSettings) BenchTime() string {
+	return do.BenchTimeFlag
+}
+
+func (do *DoSpinSettings) Timeout() time.Duration {
+	return do.TimeoutFlag
+}
+
+func (do *DoSpinSettings) Tags() []string {
+	return do.TagsFlag
+}
+
+func (do *DoSpinSettings) Run() string {
+	return do.RunFlag
+}
+
+func (do *DoSpinSettings) Short() bool {
+	return do.ShortFlag
+}
+
+func (do *DoSpinSettings) GcFlags() string {
+	return do.GcFlagsFlag
+}
+
+func (do *DoSpinSettings) LdFlags() string {
+	return do.LdFlagsFlag
+}
+
+func (do *DoSpinSettings) EnvMatrix() []EnvDimension {
+	return do.EnvMatrixFlag
+}
+
+func (do *DoSpinSettings) AptPackages() []string {
+	return do.AptPackagesFlag
+}
+
+func (do *DoSpinSettings) SetupScript() string {
+	return do.SetupScriptFlag
+}
+
+func (do *DoSpinSettings) PreBench() string {
+	return do.PreBenchFlag
+}
+
+func (do *DoSpinSettings) PostBench() string {
+	return do.PostBenchFlag
+}
+
 type DoTermSettings struct {
-	AllFlag  bool
-	IPFlag   string
-	NameFlag string
+	AllFlag     bool
+	ExpiredFlag bool
+	IPFlag      string
+	NameFlag    string
 }
 
 func (do *DoTermSettings) ShouldTerm(name, ip string) bool {
-	if do.AllFlag || do.NameFlag == name || do.IPFlag == ip {
+	if do.AllFlag || (do.NameFlag != "" && do.NameFlag == name) || (do.IPFlag != "" && do.IPFlag == ip) {
 		return true
 	}
 	return false
 }
+
+type DoSizeSettings struct {
+	MinCpuFlag int
+}
+
+func (do *DoSizeSettings) ShouldDisplay(slug string, vcpus int) bool {
+	return vcpus >= do.MinCpuFlag
+}
@@ -0,0 +1,92 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2018 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/digitalocean/godo"
+)
+
+func TestDoTermSettingsShouldTerm(t *testing.T) {
+	tests := []struct {
+		desc     string
+		settings DoTermSettings
+		name, ip string
+		want     bool
+	}{
+		{"all", DoTermSettings{AllFlag: true}, "corebench-do-1", "10.0.0.1", true},
+		{"name", DoTermSettings{NameFlag: "corebench-do-1"}, "corebench-do-1", "10.0.0.1", true},
+		{"other name", DoTermSettings{NameFlag: "corebench-do-2"}, "corebench-do-1", "10.0.0.1", false},
+		{"ip", DoTermSettings{IPFlag: "10.0.0.1"}, "corebench-do-1", "10.0.0.1", true},
+		{"other ip", DoTermSettings{IPFlag: "10.0.0.2"}, "corebench-do-1", "10.0.0.1", false},
+		{"no flags, droplet without an ip", DoTermSettings{}, "corebench-do-1", "", false},
+		{"name given, droplet without an ip", DoTermSettings{NameFlag: "corebench-do-2"}, "corebench-do-1", "", false},
+		{"expired only", DoTermSettings{ExpiredFlag: true}, "corebench-do-1", "", false},
+	}
+	for _, tt := range tests {
+		if got := tt.settings.ShouldTerm(tt.name, tt.ip); got != tt.want {
+			t.Errorf("%s: ShouldTerm(%q, %q) = %t, want %t", tt.desc, tt.name, tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestDropletsEveryPage(t *testing.T) {
+	const pages = 3
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tag := r.URL.Query().Get("tag_name"); tag != "corebench" {
+			t.Errorf("listed droplets tagged %q, want corebench", tag)
+		}
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		links := `{}`
+		if page < pages {
+			links = fmt.Sprintf(`{"pages":{"next":"http://%[1]s/v2/droplets?page=%[2]d","last":"http://%[1]s/v2/droplets?page=%[3]d"}}`,
+				r.Host, page+1, pages)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"droplets":[{"id":%d,"name":"corebench-do-%d"}],"links":%s,"meta":{"total":%d}}`, page, page, links, pages)
+	}))
+	defer srv.Close()
+
+	client, err := godo.New(srv.Client(), godo.SetBaseURL(srv.URL+"/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &DigitalOceanProvider{client: client}
+	droplets, err := p.droplets(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(droplets) != pages {
+		t.Fatalf("got %d droplets, want one from each of the %d pages", len(droplets), pages)
+	}
+	for i, d := range droplets {
+		if d.ID != i+1 {
+			t.Errorf("droplet %d has id %d, want %d", i, d.ID, i+1)
+		}
+	}
+}
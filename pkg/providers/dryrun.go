@@ -0,0 +1,90 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2018 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package providers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// dryRunID stands in for the random run id with --dry-run so the plan is the same from one run to the next.
+const dryRunID = "dry-run"
+
+// dryRunPlan is everything resolved for a run, --dry-run prints it as json instead of provisioning.
+type dryRunPlan struct {
+	Provider          string   `json:"provider"`
+	Region            string   `json:"region"`
+	Zone              string   `json:"zone,omitempty"`
+	Mode              string   `json:"mode,omitempty"`
+	InstanceType      string   `json:"instance_type"`
+	Vcpus             int      `json:"vcpus"`
+	GoArch            string   `json:"goarch"`
+	Image             string   `json:"image"`
+	Market            string   `json:"market"`
+	SSHCidr           string   `json:"ssh_cidr"`
+	MaxLifetime       string   `json:"max_lifetime"`
+	GoVersions        []string `json:"go_versions"`
+	Repository        string   `json:"repository"`
+	Ref               string   `json:"ref,omitempty"`
+	Base              string   `json:"base,omitempty"`
+	Credentials       string   `json:"credentials,omitempty"`
+	Template          string   `json:"template"`
+	BenchCommand      string   `json:"bench_command"`
+	HourlyUSD         float64  `json:"hourly_usd"`
+	EstimatedDuration string   `json:"estimated_duration"`
+	EstimatedCostUSD  float64  `json:"estimated_cost_usd"`
+	// Benchmarks is how many benchmarks the estimate assumes, BenchmarksCounted is false for --bench-estimate's guess.
+	Benchmarks             int      `json:"benchmarks"`
+	BenchmarksCounted      bool     `json:"benchmarks_counted"`
+	AwsEquivalent          string   `json:"aws_equivalent,omitempty"`
+	AwsEquivalentHourlyUSD float64  `json:"aws_equivalent_hourly_usd,omitempty"`
+	BudgetViolations       []string `json:"budget_violations"`
+}
+
+// print writes the plan to stdout, logging goes to stderr so stdout is only the plan.
+func (plan *dryRunPlan) print(estimate costEstimate) error {
+	violations, err := budgetViolations(estimate)
+	if err != nil {
+		return err
+	}
+	plan.HourlyUSD = estimate.hourly
+	plan.EstimatedDuration = (estimate.bootstrap + estimate.bench).String()
+	plan.EstimatedCostUSD = estimate.total()
+	plan.Benchmarks = estimate.benchmarks
+	plan.BenchmarksCounted = estimate.counted
+	if eq := estimate.equivalent; eq != nil {
+		plan.AwsEquivalent = eq.InstanceType
+		plan.AwsEquivalentHourlyUSD = eq.PriceHourly
+	}
+	plan.BudgetViolations = violations
+	if plan.BudgetViolations == nil {
+		plan.BudgetViolations = []string{}
+	}
+
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stdout, string(data))
+	return nil
+}
@@ -0,0 +1,112 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2018 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package providers
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// EnvDimension is an environment variable the benchmarks are run with every value of, such as GOGC=50,100,200.
+type EnvDimension struct {
+	Name   string
+	Values []string
+}
+
+// envVar is a single environment variable a variant is benchmarked with.
+type envVar struct {
+	Name  string
+	Value string
+}
+
+// envName matches the names the shell accepts for an environment variable.
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ParseEnvMatrix parses NAME=value,value,... specs, one per environment variable.
+func ParseEnvMatrix(specs []string) ([]EnvDimension, error) {
+	var dims []EnvDimension
+	given := map[string]bool{}
+	for _, spec := range specs {
+		parts := strings.SplitN(spec, "=", 2)
+		if len(parts) != 2 || !envName.MatchString(parts[0]) {
+			return nil, fmt.Errorf("%q is not NAME=value,value,...", spec)
+		}
+		if parts[0] == "GOMAXPROCS" {
+			// go test sets GOMAXPROCS to each of the -cpu values, whatever the environment says.
+			return nil, fmt.Errorf("GOMAXPROCS is set by go test for each --cpu value, give the values with --cpu instead")
+		}
+		if given[parts[0]] {
+			return nil, fmt.Errorf("%s is given twice, list all of its values at once", parts[0])
+		}
+		given[parts[0]] = true
+
+		dim := EnvDimension{Name: parts[0]}
+		for _, value := range strings.Split(parts[1], ",") {
+			if value = strings.TrimSpace(value); value == "" {
+				return nil, fmt.Errorf("%q has an empty value", spec)
+			}
+			dim.Values = append(dim.Values, value)
+		}
+		dims = append(dims, dim)
+	}
+	return dims, nil
+}
+
+// envCombinations is the cartesian product of the dimensions, with the first dimension varying slowest.
+// There's a single empty combination without any dimensions.
+func envCombinations(dims []EnvDimension) [][]envVar {
+	combinations := [][]envVar{nil}
+	for _, dim := range dims {
+		var next [][]envVar
+		for _, combination := range combinations {
+			for _, value := range dim.Values {
+				vars := append(append([]envVar(nil), combination...), envVar{Name: dim.Name, Value: value})
+				next = append(next, vars)
+			}
+		}
+		combinations = next
+	}
+	return combinations
+}
+
+// envCount is how many combinations of the dimensions are benchmarked.
+func envCount(dims []EnvDimension) int {
+	count := 1
+	for _, dim := range dims {
+		count *= len(dim.Values)
+	}
+	return count
+}
+
+// label is the benchfmt configuration key the variable's value is recorded under, keys can't have upper case.
+func (v envVar) label() string {
+	return fmt.Sprintf("env-%s: %s", strings.ToLower(v.Name), v.Value)
+}
+
+// logUnsafe matches anything in the value that doesn't belong in a file name.
+var logUnsafe = regexp.MustCompile(`[^A-Za-z0-9._=+-]`)
+
+// logName is how the variable's value is named in a log file.
+func (v envVar) logName() string {
+	return logUnsafe.ReplaceAllString(v.Name+"="+v.Value, "_")
+}
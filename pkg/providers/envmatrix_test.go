@@ -0,0 +1,124 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2018 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package providers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseEnvMatrix(t *testing.T) {
+	tests := []struct {
+		name  string
+		specs []string
+		want  []EnvDimension
+		// wantErr is part of the error expected, there's no error when it's empty.
+		wantErr string
+	}{
+		{"none", nil, nil, ""},
+		{"single", []string{"GOGC=50"}, []EnvDimension{{"GOGC", []string{"50"}}}, ""},
+		{"values", []string{"GOGC=50, 100,200"}, []EnvDimension{{"GOGC", []string{"50", "100", "200"}}}, ""},
+		{"order kept", []string{"GOGC=off,50", "GOMEMLIMIT=1GiB"},
+			[]EnvDimension{{"GOGC", []string{"off", "50"}}, {"GOMEMLIMIT", []string{"1GiB"}}}, ""},
+		{"value with equals", []string{"GODEBUG=madvdontneed=1"}, []EnvDimension{{"GODEBUG", []string{"madvdontneed=1"}}}, ""},
+		{"duplicate", []string{"GOGC=50", "GOGC=100"}, nil, "GOGC is given twice"},
+		{"empty value", []string{"GOGC=50,,100"}, nil, "has an empty value"},
+		{"trailing comma", []string{"GOGC=50,"}, nil, "has an empty value"},
+		{"no values", []string{"GOGC="}, nil, "has an empty value"},
+		{"no equals", []string{"GOGC"}, nil, "is not NAME=value"},
+		{"bad name", []string{"GO-GC=50"}, nil, "is not NAME=value"},
+		{"empty name", []string{"=50"}, nil, "is not NAME=value"},
+		{"gomaxprocs", []string{"GOMAXPROCS=1,2"}, nil, "--cpu"},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseEnvMatrix(tt.specs)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: got error %v, want one containing %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEnvCombinations(t *testing.T) {
+	tests := []struct {
+		name string
+		dims []EnvDimension
+		// want is each combination's values joined by spaces.
+		want []string
+	}{
+		{"none", nil, []string{""}},
+		{"single", []EnvDimension{{"GOGC", []string{"50", "100"}}}, []string{"GOGC=50", "GOGC=100"}},
+		{"first varies slowest", []EnvDimension{{"GOGC", []string{"50", "100"}}, {"GOMEMLIMIT", []string{"1GiB", "2GiB", "4GiB"}}},
+			[]string{
+				"GOGC=50 GOMEMLIMIT=1GiB", "GOGC=50 GOMEMLIMIT=2GiB", "GOGC=50 GOMEMLIMIT=4GiB",
+				"GOGC=100 GOMEMLIMIT=1GiB", "GOGC=100 GOMEMLIMIT=2GiB", "GOGC=100 GOMEMLIMIT=4GiB",
+			}},
+		{"three", []EnvDimension{{"A", []string{"1", "2"}}, {"B", []string{"1"}}, {"C", []string{"1", "2"}}},
+			[]string{"A=1 B=1 C=1", "A=1 B=1 C=2", "A=2 B=1 C=1", "A=2 B=1 C=2"}},
+	}
+
+	for _, tt := range tests {
+		var got []string
+		for _, combination := range envCombinations(tt.dims) {
+			var vars []string
+			for _, v := range combination {
+				vars = append(vars, v.Name+"="+v.Value)
+			}
+			got = append(got, strings.Join(vars, " "))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+		if count := envCount(tt.dims); count != len(tt.want) {
+			t.Errorf("%s: envCount is %d, want %d", tt.name, count, len(tt.want))
+		}
+	}
+}
+
+func TestEnvLogNames(t *testing.T) {
+	toolchains := []goToolchain{{Version: "1.21.0"}}
+	dims := []EnvDimension{{"GOGC", []string{"50", "off"}}, {"GODEBUG", []string{"madvdontneed=1"}}, {"GOMEMLIMIT", []string{"1 GiB"}}}
+	variants, _ := benchVariants(toolchains, dims, false)
+
+	want := []string{
+		"GOGC=50-GODEBUG=madvdontneed=1-GOMEMLIMIT=1_GiB.log",
+		"GOGC=off-GODEBUG=madvdontneed=1-GOMEMLIMIT=1_GiB.log",
+	}
+	var got []string
+	for _, v := range variants {
+		got = append(got, v.Log)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -21,10 +21,16 @@ SOFTWARE.
 
 package providers
 
-import "context"
+import (
+	"context"
+	"time"
+
+	"github.com/deckarep/corebench/pkg/ledger"
+)
 
 type ProviderSpinSettings interface {
-	GoVersion() string
+	// GoVersions are the go versions to benchmark with, each is installed side by side on the same instance.
+	GoVersions() []string
 	GitURL() string
 	Cpus() string
 	InstanceTypeString() string
@@ -34,12 +40,64 @@ type ProviderSpinSettings interface {
 	LeaveRunning() bool
 	Count() int
 	Stat() bool
+	ResultsFile() string
+	// SSHCidr restricts ssh access to the instance, the caller's public ip is detected when empty.
+	SSHCidr() string
+	// MaxLifetime is how long the instance may live before it shuts itself down, zero disables it.
+	MaxLifetime() time.Duration
+	// BenchEstimate is the number of benchmarks expected to run, it's only used to estimate the cost.
+	BenchEstimate() int
+	// OverrideBudget allows a run that would exceed the budget.
+	OverrideBudget() bool
+	// DryRun prints what would be provisioned as json instead of provisioning it.
+	DryRun() bool
+	// Ref is the branch, tag, commit or pull request to benchmark, the default branch when empty.
+	Ref() string
+	// Base is the revision to compare the Ref against on the same instance, nothing is compared when empty.
+	Base() string
+	// Vendor includes the vendor directory when a local directory is uploaded.
+	Vendor() bool
+	// ForwardAgent clones a private repository with the local ssh agent forwarded over corebench's ssh session.
+	ForwardAgent() bool
+	// GitToken clones a private repository over https with the token, it's sent over corebench's ssh session.
+	GitToken() string
+	// GoPrivate is the GOPRIVATE pattern of the private modules, the repository's owner when empty.
+	GoPrivate() string
+	// Packages are the package patterns benchmarked, relative to the package given, it's only that package when empty.
+	Packages() []string
+	// BenchTime is go test's -benchtime, a duration or a number of iterations such as 100x.
+	BenchTime() string
+	// Timeout is go test's -timeout, its default when zero.
+	Timeout() time.Duration
+	// Tags are the build tags the benchmarks are built with.
+	Tags() []string
+	// Run is go test's -run, ^$ skips the tests and every test runs when it's empty.
+	Run() string
+	// Short is go test's -short.
+	Short() bool
+	// GcFlags and LdFlags are passed to go test's -gcflags and -ldflags.
+	GcFlags() string
+	LdFlags() string
+	// EnvMatrix are environment variables every benchmark is run with each combination of the values of.
+	EnvMatrix() []EnvDimension
+	// AptPackages are installed on the instance before the SetupScript runs.
+	AptPackages() []string
+	// SetupScript runs as root while the instance bootstraps, once go is installed and before the source is fetched.
+	SetupScript() string
+	// PreBench runs in the package's directory before the benchmarks, which are skipped when it fails.
+	PreBench() string
+	// PostBench runs in the package's directory after the benchmarks, whether they passed or not.
+	PostBench() string
 }
 
 type ProviderTermSettings interface {
 	ShouldTerm(name, ip string) bool
 }
 
+type ProviderSizeSettings interface {
+	ShouldDisplay(name string, vcpus int) bool
+}
+
 // Provider is some type of provider.
 type Provider interface {
 	// Spinup provisions and benchmarks in one shot.
@@ -51,5 +109,23 @@ type Provider interface {
 	// Term terminates instance provisioned by corebench.
 	Term(context.Context, ProviderTermSettings) error
 	// Sizes lists the box sizes that can be provisioned by the provider.
-	Sizes(context.Context) error
+	Sizes(context.Context, ProviderSizeSettings) error
+	// Cleanup tears down the resources the ledger recorded for a run.
+	Cleanup(context.Context, ledger.Run) error
+	// Resources lists every resource created by corebench, in the order they can be deleted in.
+	Resources(context.Context) ([]Resource, error)
+	// DeleteResource deletes a single resource found by Resources.
+	DeleteResource(context.Context, Resource) error
+}
+
+// Resource is a cloud resource created by corebench.
+type Resource struct {
+	Provider string
+	Kind     string
+	ID       string
+	Name     string
+	// RunID is the id the run is kept under in the ledger.
+	RunID string
+	// Created is the zero time when the provider doesn't say when the resource was created.
+	Created time.Time
 }
@@ -0,0 +1,69 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2018 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package providers
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// results is where benchmark output goes: always stdout, and the results file when one was given.
+// Results are kept in the go benchmark data format where "key: value" configuration lines label
+// the benchmarks that follow them, so runs of different setups can be told apart and compared.
+type results struct {
+	io.Writer
+	file *os.File
+}
+
+func newResults(path string) (*results, error) {
+	if path == "" {
+		return &results{Writer: os.Stdout}, nil
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &results{
+		Writer: io.MultiWriter(os.Stdout, f),
+		file:   f,
+	}, nil
+}
+
+// Label records a configuration line that applies to all of the benchmark output after it.
+func (r *results) Label(key, value string) {
+	fmt.Fprintf(r, "%s: %s\n", key, value)
+}
+
+// Note records a line that labels nothing, readers of the format such as benchstat skip it. It's for what's only
+// known after the benchmarks, a label there would apply to no results or to the results of a retry.
+func (r *results) Note(format string, args ...interface{}) {
+	fmt.Fprintf(r, "# "+format+"\n", args...)
+}
+
+func (r *results) Close() error {
+	if r.file == nil {
+		return nil
+	}
+	return r.file.Close()
+}
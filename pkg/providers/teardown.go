@@ -0,0 +1,59 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2018 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package providers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/deckarep/corebench/pkg/ledger"
+)
+
+// teardownRun tears down everything the ledger has recorded for the run and then forgets it. It uses
+// a fresh context so teardown still happens after an interrupt has cancelled the run's context.
+func teardownRun(p Provider, book *ledger.Ledger, runID string) error {
+	run, ok, err := book.Lookup(runID)
+	if err != nil || !ok {
+		return err
+	}
+
+	if err := p.Cleanup(context.Background(), run); err != nil {
+		log.WithField("run", runID).Errorf("Resources are still alive and billing: %s", err)
+		log.WithField("run", runID).Error("Run \"corebench cleanup\" to retry or delete them manually")
+		return err
+	}
+	return book.Forget(runID)
+}
+
+// shutdownCommand schedules the instance to power itself off once its lifetime is up, it's a last line of
+// defense for when corebench never comes back to tear it down. Upstart's shutdown waits out the delay in the
+// foreground, unlike systemd's, so it's detached from the bootstrap to outlive it without holding it up.
+func shutdownCommand(lifetime time.Duration) string {
+	if lifetime <= 0 {
+		return "true"
+	}
+	return fmt.Sprintf("(setsid nohup shutdown -h +%d > /dev/null 2>&1 &)", int(math.Ceil(lifetime.Minutes())))
+}
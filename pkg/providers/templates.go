@@ -0,0 +1,510 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2018 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package providers
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/deckarep/corebench/pkg/repo"
+	"github.com/deckarep/corebench/pkg/toolchain"
+)
+
+// templateData is what every template is rendered with. The providers only differ in the instance they
+// launch, everything else comes from the settings and the source under test.
+type templateData struct {
+	// User runs the benchmarks over ssh, GoPath is in their home directory.
+	User   string
+	GoPath string
+	// Toolchains are installed side by side, Go is the newest of them and the one dependencies are fetched with.
+	Toolchains      []goToolchain
+	Go              goToolchain
+	ShutdownCommand string
+	Source          *repo.Source
+	// ForwardAgent, GitTokenUser and GoPrivate set up the credentials a private repository is cloned with.
+	ForwardAgent bool
+	GitTokenUser string
+	GoPrivate    string
+
+	// Cpus is the instance's every cpu when it's empty, TestFlags are every other go test flag.
+	Cpus      string
+	Count     int
+	TestFlags []string
+	Packages  []string
+	Stat      bool
+	// SpotWatch warns that the results are partial when a spot instance is interrupted mid benchmark.
+	SpotWatch bool
+	// Variants are benchmarked in turn when there's more than a single revision and toolchain, Comparisons
+	// are the logs benchstat compares once they're done.
+	Variants    []benchVariant
+	Comparisons [][]string
+
+	// AptPackages and SetupScript are installed and run as root by the bootstrap, before the source is fetched.
+	AptPackages []string
+	SetupScript string
+	// PreBench and PostBench run in the package's directory before and after the benchmarks.
+	PreBench  string
+	PostBench string
+
+	// Stack is only set for the cloudformation template.
+	Stack *awsStackData
+}
+
+// awsStackData fills in the parameters of the cloudformation template.
+type awsStackData struct {
+	KeyName      string
+	AMI          string
+	InstanceType string
+	Zone         string
+	SSHCidr      string
+	MarketType   string
+	SpotMaxPrice string
+	// Bootstrap is the rendered bootstrap script, escaped for !Sub.
+	Bootstrap string
+	// SignalTimeout is how long the bootstrap has to signal it's finished, as an ISO 8601 duration.
+	SignalTimeout string
+}
+
+// goToolchain is a go toolchain installed on the instance in a directory of its own.
+type goToolchain struct {
+	// Version is the release or tip.
+	Version string
+	Tip     bool
+	// Archive is the release installed, tip is built with it.
+	Archive toolchain.File
+}
+
+// Dir is where the toolchain is installed.
+func (g goToolchain) Dir() string {
+	return "/usr/local/corebench/" + g.Version
+}
+
+// Root is the toolchain's GOROOT.
+func (g goToolchain) Root() string {
+	return g.Dir() + "/go"
+}
+
+// benchVariant is one of the combinations benchmarked in turn, a revision built with a toolchain and run
+// with a set of environment variables. Each is logged separately so they can be compared against each other.
+type benchVariant struct {
+	// Name is the shell function that benchmarks the variant.
+	Name string
+	Go   goToolchain
+	Env  []envVar
+	// Base is whether the base revision is benchmarked rather than the head.
+	Base bool
+	// Labels are the benchfmt configuration lines its results are tagged with.
+	Labels []string
+	// Log is the file in the home directory its results are collected in.
+	Log string
+}
+
+// newTemplateData fills in everything that's the same whichever provider launches the instance.
+func newTemplateData(settings ProviderSpinSettings, src *repo.Source, tcs []*toolchain.Toolchain, user, goarch string) templateData {
+	goPath := "/home/" + user + "/go"
+	if user == "root" {
+		goPath = "/root/go"
+	}
+	data := templateData{
+		User:            user,
+		GoPath:          goPath,
+		ShutdownCommand: shutdownCommand(settings.MaxLifetime()),
+		Source:          src,
+		ForwardAgent:    settings.ForwardAgent(),
+		GoPrivate:       settings.GoPrivate(),
+		Cpus:            settings.Cpus(),
+		Count:           settings.Count(),
+		TestFlags:       goTestFlags(settings),
+		Packages:        settings.Packages(),
+		Stat:            settings.Stat(),
+		AptPackages:     settings.AptPackages(),
+		SetupScript:     strings.TrimRight(settings.SetupScript(), "\n"),
+		PreBench:        settings.PreBench(),
+		PostBench:       settings.PostBench(),
+	}
+	newest := tcs[0]
+	for _, tc := range tcs {
+		// The archives were checked for when the run started.
+		archive, _ := tc.Archive("linux", goarch)
+		data.Toolchains = append(data.Toolchains, goToolchain{Version: tc.Version, Tip: tc.Tip(), Archive: archive})
+		if tc.Newer(newest) {
+			newest = tc
+		}
+	}
+	for _, g := range data.Toolchains {
+		if g.Version == newest.Version {
+			data.Go = g
+		}
+	}
+	data.Variants, data.Comparisons = benchVariants(data.Toolchains, settings.EnvMatrix(), src.Base != "")
+	if data.GoPrivate == "" {
+		data.GoPrivate = src.Owner()
+	}
+	data.GitTokenUser = gitTokenUsers[src.Host()]
+	if data.GitTokenUser == "" {
+		data.GitTokenUser = "x-access-token"
+	}
+	return data
+}
+
+// goTestFlags are the go test flags every benchmark run is given, aside from -cpu and -count which the
+// bench command varies itself.
+func goTestFlags(settings ProviderSpinSettings) []string {
+	flags := []string{"-bench=" + settings.Regex()}
+	if run := settings.Run(); run != "" {
+		flags = append(flags, "-run="+run)
+	}
+	if settings.BenchMemString() != "" {
+		flags = append(flags, "-benchmem")
+	}
+	if benchTime := settings.BenchTime(); benchTime != "" {
+		flags = append(flags, "-benchtime="+benchTime)
+	}
+	if timeout := settings.Timeout(); timeout > 0 {
+		flags = append(flags, "-timeout="+timeout.String())
+	}
+	if tags := settings.Tags(); len(tags) > 0 {
+		flags = append(flags, "-tags="+strings.Join(tags, ","))
+	}
+	if settings.Short() {
+		flags = append(flags, "-short")
+	}
+	if gcflags := settings.GcFlags(); gcflags != "" {
+		flags = append(flags, "-gcflags="+gcflags)
+	}
+	if ldflags := settings.LdFlags(); ldflags != "" {
+		flags = append(flags, "-ldflags="+ldflags)
+	}
+	return flags
+}
+
+// benchVariants are the combinations of toolchain, environment and revision benchmarked in turn, and the logs
+// compared once they're done: the base against the head for every toolchain and environment, otherwise all of
+// them against each other. A single toolchain without a base or an environment matrix has nothing to compare,
+// so it has no variants.
+func benchVariants(toolchains []goToolchain, envMatrix []EnvDimension, compare bool) ([]benchVariant, [][]string) {
+	if len(toolchains) == 1 && len(envMatrix) == 0 && !compare {
+		return nil, nil
+	}
+	revisions := []bool{false}
+	if compare {
+		revisions = []bool{true, false}
+	}
+	var variants []benchVariant
+	var comparisons [][]string
+	var matrix []string
+	for _, g := range toolchains {
+		for _, env := range envCombinations(envMatrix) {
+			var logs []string
+			for _, base := range revisions {
+				v := benchVariant{
+					Name:   fmt.Sprintf("bench_%d", len(variants)),
+					Go:     g,
+					Env:    env,
+					Base:   base,
+					Labels: []string{"go-version: " + g.Version},
+				}
+				var name []string
+				if len(toolchains) > 1 {
+					name = append(name, g.Version)
+				}
+				for _, e := range env {
+					v.Labels = append(v.Labels, e.label())
+					name = append(name, e.logName())
+				}
+				if compare {
+					revision := "head"
+					if base {
+						revision = "base"
+					}
+					v.Labels = append(v.Labels, "corebench-revision: "+revision)
+					name = append(name, revision)
+				}
+				v.Log = strings.Join(name, "-") + ".log"
+				variants = append(variants, v)
+				logs = append(logs, v.Log)
+			}
+			if compare {
+				comparisons = append(comparisons, logs)
+			} else {
+				matrix = append(matrix, logs...)
+			}
+		}
+	}
+	if matrix != nil {
+		comparisons = append(comparisons, matrix)
+	}
+	return variants, comparisons
+}
+
+// WorkDir is where the repository is cloned to, where GOPATH mode expects it so repos without a go.mod
+// still build, module mode doesn't mind either way.
+func (d templateData) WorkDir() string {
+	return "$GOPATH/src/" + d.Source.Root
+}
+
+// PackageDir is where the package under test is benchmarked from.
+func (d templateData) PackageDir() string {
+	return "$GOPATH/src/" + d.packagePath(majorDirVar)
+}
+
+// BaseWorkDir is where the base revision is checked out when comparing, in a GOPATH of its own.
+func (d templateData) BaseWorkDir() string {
+	return "$GOPATH/base/src/" + d.Source.Root
+}
+
+// BasePackageDir is where the base revision's package is benchmarked from.
+func (d templateData) BasePackageDir() string {
+	return "$GOPATH/base/src/" + d.packagePath(baseMajorDirVar)
+}
+
+// majorDirVar and baseMajorDirVar hold the directory a major version suffix names in the checkouts, they're
+// only known once the repository's been cloned.
+const (
+	majorDirVar     = "COREBENCH_MAJOR_DIR"
+	baseMajorDirVar = "COREBENCH_BASE_MAJOR_DIR"
+)
+
+// packagePath is the package's path within the GOPATH, with its major version suffix left to the variable.
+func (d templateData) packagePath(variable string) string {
+	major := d.Source.MajorVersion()
+	if major == "" {
+		return d.Source.ImportPath
+	}
+	return d.Source.Root + "${" + variable + "}" + strings.TrimPrefix(d.Source.Subdir(), major)
+}
+
+// MajorDir and BaseMajorDir work out the directory the major version suffix names in the checkouts.
+func (d templateData) MajorDir() string {
+	return d.majorDir(majorDirVar, d.WorkDir())
+}
+
+func (d templateData) BaseMajorDir() string {
+	return d.majorDir(baseMajorDirVar, d.BaseWorkDir())
+}
+
+// majorDir sets the variable to the major version suffix's directory in the checkout, which is the checkout
+// itself when its go.mod declares the suffixed module path as the major branch layout does, and records it
+// for the benchmarks.
+func (d templateData) majorDir(variable, workDir string) string {
+	major := d.Source.MajorVersion()
+	module := `^module[[:space:]]+"?` + regexp.QuoteMeta(d.Source.Root+"/"+major) + `"?[[:space:]]*(//.*)?$`
+	return fmt.Sprintf(`%[1]s=/%[2]s; if grep -Eq %[3]s %[4]s/go.mod 2>/dev/null; then %[1]s=; fi; echo "export %[1]s=$%[1]s" >> $GOPATH/.core-env`,
+		variable, major, shellQuote(module), workDir)
+}
+
+// render executes the named template. The templates are fixed and the data is typed, so failing is a bug.
+func render(name string, data templateData) string {
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, name, data); err != nil {
+		panic(fmt.Sprintf("failed to render the %s template: %s", name, err))
+	}
+	return buf.String()
+}
+
+// indent prefixes every line but the first, which the template has already indented, empty lines are left alone.
+func indent(prefix, text string) string {
+	lines := strings.Split(text, "\n")
+	for i := 1; i < len(lines); i++ {
+		if lines[i] != "" {
+			lines[i] = prefix + lines[i]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// reverse is the variants in the opposite order.
+func reverse(variants []benchVariant) []benchVariant {
+	reversed := make([]benchVariant, len(variants))
+	for i, v := range variants {
+		reversed[len(variants)-1-i] = v
+	}
+	return reversed
+}
+
+var templates = template.Must(template.Must(template.New("").Funcs(template.FuncMap{
+	"quote":   shellQuote,
+	"indent":  indent,
+	"reverse": reverse,
+}).Parse(scriptTemplates)).New("cfn").Parse(CfnTemplate))
+
+// scriptTemplates are the shell scripts run on the instance, shared by every provider.
+//
+// bootstrap: installs go, benchstat and the source under test as root when the instance first boots.
+// user-data: the bootstrap as a script of its own, for providers that take it as user data.
+// fetch-source: clones the repository, checks out the revisions under test and fetches their dependencies.
+// go-download: fetches the dependencies of the package under test from within its directory. A repo with a
+// go.mod, or a go.work above it, is built in module mode and anything else falls back to GOPATH mode for
+// every later go command.
+// ready: waits for the bootstrap to finish, and fails if it did.
+// upload: unpacks an uploaded directory and fetches its dependencies, once the bootstrap is done.
+// clone: clones a private repository with the credentials corebench sends over its ssh session.
+// go-install: installs a toolchain in its own directory, verifying the archive, and builds tip with it.
+// bench: runs the benchmarks, along with the hooks around them.
+// variants: benchmarks every variant on the same instance one count at a time, reversing their order every
+// iteration so drift over the run affects them all equally, then compares them with benchstat. The base
+// runs with its own GOPATH ahead of the shared one so GOPATH mode builds its packages rather than the head's.
+const scriptTemplates = `
+{{- define "bootstrap"}}{{.ShutdownCommand}}
+echo "Setting up corebench for the first time..."
+echo "Installing dependencies..."
+export HOME=/root
+export GOROOT=/usr/local/go
+export GOPATH={{.GoPath}}
+mkdir -p $GOPATH
+touch $GOPATH/.core-env
+{{/* go 1.21 and later switch to the toolchain a go.mod asks for, which isn't the go under test */ -}}
+export GOTOOLCHAIN=local && echo "export GOTOOLCHAIN=local" >> $GOPATH/.core-env
+apt-get -y install git
+{{- range .Toolchains}}
+{{template "go-install" .}}
+{{- end}}
+ln -sfn {{.Go.Root}} $GOROOT
+$GOROOT/bin/go install golang.org/x/perf/cmd/benchstat@latest || GO111MODULE=off $GOROOT/bin/go get golang.org/x/perf/cmd/benchstat
+{{- if .AptPackages}}
+apt-get -y install{{range .AptPackages}} {{quote .}}{{end}} || echo "failed to install the apt packages" >> $GOPATH/.core-failed
+{{- end}}
+{{- if .SetupScript}}
+echo "Running the setup script..."
+cat > /tmp/corebench-setup <<'COREBENCH_SETUP'
+{{.SetupScript}}
+COREBENCH_SETUP
+chmod +x /tmp/corebench-setup && /tmp/corebench-setup || echo "the setup script failed" >> $GOPATH/.core-failed
+{{- end}}
+{{if .Source.Local}}echo "The source is uploaded by corebench once the bootstrap finishes"
+{{- else if .Source.Private}}echo "The source is cloned by corebench over ssh once the bootstrap finishes"
+{{- else}}{{template "fetch-source" .}}{{end}}
+{{- if ne .User "root"}}
+chown -R {{.User}}:{{.User}} $GOPATH
+{{- end}}
+touch $GOPATH/.core-init
+echo "Finished corebench initialization"
+{{end}}
+
+{{- define "go-install"}}mkdir -p {{.Dir}} && wget -q -O {{.Archive.Filename}} {{.Archive.URL}} && echo '{{.Archive.SHA256}}  {{.Archive.Filename}}' | sha256sum -c - && tar -C {{.Dir}} -xzf {{.Archive.Filename}} || echo "failed to install {{.Archive.Filename}}, the download failed or its checksum doesn't match" >> $GOPATH/.core-failed
+{{- if .Tip}}
+echo "Building go at tip..."
+git clone -q --depth 1 https://go.googlesource.com/go {{.Dir}}/tip && (cd {{.Dir}}/tip/src && GOROOT_BOOTSTRAP={{.Root}} ./make.bash) && rm -rf {{.Root}} && mv {{.Dir}}/tip {{.Root}} || echo "failed to build go at tip" >> $GOPATH/.core-failed
+{{- end}}{{end}}
+
+{{- define "user-data"}}#!/bin/bash -x
+apt-get update
+{{template "bootstrap" .}}{{end}}
+
+{{- define "fetch-source"}}git clone {{quote .Source.CloneURL}} {{.WorkDir}} || echo {{quote (printf "failed to clone %s" .Source.CloneURL)}} >> $GOPATH/.core-failed
+cd {{.WorkDir}}
+{{- with .Source.Refspec}}
+(git fetch -q origin {{quote .}} && git checkout -q --detach FETCH_HEAD) || git checkout -q --detach {{quote .}} || echo {{quote (printf "failed to check out %s" .)}} >> $GOPATH/.core-failed
+{{- end}}
+{{- if .Source.MajorVersion}}
+{{.MajorDir}}
+{{- end}}
+{{- with .Source.BaseRefspec}}
+(git fetch -q origin {{quote (printf "+%s:refs/corebench/base" .)}} || git update-ref refs/corebench/base "$(git rev-parse -q --verify {{quote (printf "%s^{commit}" .)}})") && git clone -q --shared {{$.WorkDir}} {{$.BaseWorkDir}} && cd {{$.BaseWorkDir}} && git fetch -q origin refs/corebench/base && git checkout -q --detach FETCH_HEAD || echo {{quote (printf "failed to check out %s" .)}} >> $GOPATH/.core-failed; cd {{$.WorkDir}}
+{{- if $.Source.MajorVersion}}
+{{$.BaseMajorDir}}
+{{- end}}
+{{- end}}
+cd {{.PackageDir}}
+{{template "go-download" .}}
+{{- if .Source.BaseRefspec}}
+(. $GOPATH/.core-env; cd {{.BasePackageDir}} && export GOPATH=$GOPATH/base:$GOPATH && if [ "$GO111MODULE" = "off" ]; then $GOROOT/bin/go get -d -t ./...; else $GOROOT/bin/go list -deps -test ./... > /dev/null; fi)
+{{- end}}{{end}}
+
+{{- define "go-download"}}gomod=$($GOROOT/bin/go env GOMOD 2>/dev/null); if [ -z "$gomod" ] || [ "$gomod" = "/dev/null" ]; then echo "export GO111MODULE=off" >> $GOPATH/.core-env; GO111MODULE=off $GOROOT/bin/go get -d -t ./...; elif [ -n "$($GOROOT/bin/go env GOWORK 2>/dev/null)" ]; then $GOROOT/bin/go list -deps -test ./... > /dev/null; else $GOROOT/bin/go mod download; fi{{end}}
+
+{{- define "ready"}}export GOPATH={{.GoPath}} && while [ ! -f $GOPATH/.core-init ]; do sleep 1; done && if [ -f $GOPATH/.core-failed ]; then cat $GOPATH/.core-failed >&2; exit 1; fi && . $GOPATH/.core-env{{end}}
+
+{{- define "upload"}}{{template "ready" .}} && mkdir -p {{.WorkDir}} && tar -xzf - -C {{.WorkDir}} && cd {{.PackageDir}} && export GOROOT=/usr/local/go && ({{template "go-download" .}}){{end}}
+
+{{- define "clone"}}{{template "ready" .}} || exit 1
+export GOROOT=/usr/local/go GIT_TERMINAL_PROMPT=0 GOPRIVATE={{quote .GoPrivate}}
+echo export GOPRIVATE={{quote .GoPrivate}} >> $GOPATH/.core-env
+{{- if .ForwardAgent}}
+mkdir -p $HOME/.ssh && ssh-keyscan {{quote .Source.Host}} >> $HOME/.ssh/known_hosts 2>/dev/null
+git config --global url.{{quote (printf "git@%s:" .Source.Host)}}.insteadOf {{quote (printf "https://%s/" .Source.Host)}}
+{{- else}}
+read -r CB_GIT_TOKEN
+(umask 077 && printf 'https://{{.GitTokenUser}}:%s@{{.Source.Host}}\n' "$CB_GIT_TOKEN" > $HOME/.corebench-git-credentials)
+unset CB_GIT_TOKEN
+git config --global credential.helper "store --file=$HOME/.corebench-git-credentials"
+git config --global url.{{quote (printf "https://%s/" .Source.Host)}}.insteadOf {{quote (printf "git@%s:" .Source.Host)}}
+{{- end}}
+{{template "fetch-source" .}}
+{{- if .ForwardAgent}}
+git config --global --unset url.{{quote (printf "git@%s:" .Source.Host)}}.insteadOf
+{{- else}}
+rm -f $HOME/.corebench-git-credentials
+git config --global --unset credential.helper
+git config --global --unset url.{{quote (printf "https://%s/" .Source.Host)}}.insteadOf
+{{- end}}
+test ! -f $GOPATH/.core-failed{{end}}
+
+{{- define "revision-labels"}}
+{{- if not .Source.Local}}echo "corebench-commit: $(git rev-parse HEAD)" && echo "corebench-describe: $(git describe --tags --always --dirty)"
+{{- else if .Source.Commit}}echo {{quote (printf "corebench-commit: %s" .Source.Commit)}} && echo {{quote (printf "corebench-describe: %s" .Source.Describe)}}
+{{- else}}true{{end}}{{end}}
+
+{{- define "go-test-flags"}}{{range .TestFlags}}{{quote .}} {{end}}-cpu {{with .Cpus}}{{quote .}}{{else}}"$(nproc)"{{end}}{{end}}
+
+{{- define "packages"}}{{range .Packages}} {{quote .}}{{end}}{{end}}
+
+{{- define "bench"}}{{template "ready" .}} || exit 1
+{{- if .SpotWatch}}
+(while sleep 5; do if curl -sf http://169.254.169.254/latest/meta-data/spot/instance-action > /dev/null; then echo "corebench: spot interruption notice received, benchmark results will be partial" >&2; break; fi; done) &
+spot_watch=$!
+trap 'kill $spot_watch 2>/dev/null' EXIT
+{{- end}}
+{{- with .PreBench}}
+(cd {{$.PackageDir}} || exit 1
+{{.}}
+) || { echo "corebench: the pre-bench hook failed" >&2; exit 1; }
+{{- end}}
+(set -o pipefail
+{{- if .Variants}}
+{{template "variants" .}}
+{{- else}}
+cd {{.PackageDir}} && echo {{quote (printf "go-version: %s" .Go.Version)}} && {{template "revision-labels" .}} && /usr/local/go/bin/go version && /usr/local/go/bin/go test {{template "go-test-flags" .}} -count={{.Count}}{{template "packages" .}}
+{{- if .Stat}} | tee benchmark.log && echo '\n\n' && $GOPATH/bin/benchstat benchmark.log{{end}}
+{{- end}}
+)
+status=$?
+{{- with .PostBench}}
+(cd {{$.PackageDir}} || exit 1
+{{.}}
+) || echo "corebench: the post-bench hook failed" >&2
+{{- end}}
+exit $status{{end}}
+
+{{- define "variants"}}{{range .Toolchains}}{{.Root}}/bin/go version && {{end}}rm -f{{range .Variants}} $HOME/{{quote .Log}}{{end}}
+{{- range .Variants}}
+{{.Name}}() { cd {{if .Base}}{{$.BasePackageDir}}{{else}}{{$.PackageDir}}{{end}}{{range .Labels}} && echo {{quote .}}{{end}} && {{template "revision-labels" $}} && {{if .Base}}GOPATH=$GOPATH/base:$GOPATH {{end}}{{range .Env}}{{.Name}}={{quote .Value}} {{end}}{{.Go.Root}}/bin/go test {{template "go-test-flags" $}} -count=1{{template "packages" $}} | tee -a $HOME/{{quote .Log}}; }
+{{- end}}
+for i in $(seq {{.Count}}); do if [ $((i % 2)) -eq 1 ]; then {{range $i, $v := .Variants}}{{if $i}} && {{end}}{{$v.Name}}{{end}}; else {{range $i, $v := reverse .Variants}}{{if $i}} && {{end}}{{$v.Name}}{{end}}; fi || exit 1; done
+cd $HOME
+{{- range .Comparisons}}
+echo '\n\n' && $GOPATH/bin/benchstat{{range .}} {{quote .}}{{end}}
+{{- end}}{{end}}
+`
@@ -0,0 +1,233 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2018 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package providers
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/deckarep/corebench/pkg/repo"
+)
+
+// hostileSettings has flag values the shell would split, expand or run if they weren't quoted.
+func hostileSettings() *DoSpinSettings {
+	return &DoSpinSettings{
+		Cpu:           "1,2",
+		Benchmem:      true,
+		RegexFlag:     `Benchmark(Foo|Bar)/it's $(touch pwned) a; b`,
+		RunFlag:       "^$",
+		BenchTimeFlag: "100x",
+		TimeoutFlag:   time.Hour,
+		TagsFlag:      []string{"integration", "$HOME"},
+		GcFlagsFlag:   "all=-N -l",
+		LdFlagsFlag:   `-X 'main.version=$(git describe)' -X "main.user=${USER}" -s`,
+	}
+}
+
+func TestBenchQuoting(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh isn't installed")
+	}
+	settings := hostileSettings()
+	flags := goTestFlags(settings)
+	tc := goToolchain{Version: "1.21.0"}
+	data := templateData{
+		GoPath:    "/root/go",
+		Source:    &repo.Source{ImportPath: "github.com/o/r", Root: "github.com/o/r"},
+		Go:        tc,
+		Cpus:      settings.Cpus(),
+		Count:     1,
+		TestFlags: flags,
+		Packages:  []string{"./...", "it's here"},
+	}
+
+	// go test is handed every flag exactly as it was given, followed by the cpus.
+	out, err := exec.Command("sh", "-c", "printf '%s\\n' "+render("go-test-flags", data)).Output()
+	if err != nil {
+		t.Fatalf("go-test-flags: %s", err)
+	}
+	want := append(append([]string(nil), flags...), "-cpu", "1,2")
+	if got := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n"); !reflect.DeepEqual(got, want) {
+		t.Errorf("go-test-flags: got %q, want %q", got, want)
+	}
+
+	variants := data
+	variants.Toolchains = []goToolchain{tc, {Version: "1.20.0"}}
+	variants.Variants, variants.Comparisons = benchVariants(variants.Toolchains, nil, false)
+	for name, d := range map[string]templateData{"single": data, "variants": variants} {
+		script := render("bench", d)
+		if out, err := exec.Command("sh", "-n", "-c", script).CombinedOutput(); err != nil {
+			t.Errorf("%s: the bench script doesn't parse: %s\n%s\n%s", name, err, out, script)
+		}
+	}
+}
+
+func TestGoTestFlags(t *testing.T) {
+	want := []string{
+		`-bench=Benchmark(Foo|Bar)/it's $(touch pwned) a; b`,
+		"-run=^$",
+		"-benchmem",
+		"-benchtime=100x",
+		"-timeout=1h0m0s",
+		"-tags=integration,$HOME",
+		"-gcflags=all=-N -l",
+		`-ldflags=-X 'main.version=$(git describe)' -X "main.user=${USER}" -s`,
+	}
+	if got := goTestFlags(hostileSettings()); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := goTestFlags(&DoSpinSettings{}); !reflect.DeepEqual(got, []string{"-bench=."}) {
+		t.Errorf("defaults: got %q, want only -bench=.", got)
+	}
+}
+
+func TestRunTime(t *testing.T) {
+	tests := []struct {
+		benchtime string
+		want      time.Duration
+	}{
+		{"", benchTime},
+		{"2s", 2 * time.Second},
+		{"1m30s", 90 * time.Second},
+		{"100x", benchTime},
+		{"0s", benchTime},
+		{"-1s", benchTime},
+	}
+
+	for _, tt := range tests {
+		if got := runTime(tt.benchtime); got != tt.want {
+			t.Errorf("%q: got %s, want %s", tt.benchtime, got, tt.want)
+		}
+	}
+}
+
+func TestBenchSpotWatch(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash isn't installed")
+	}
+	dir := t.TempDir()
+	src := &repo.Source{ImportPath: "github.com/o/r", Root: "github.com/o/r"}
+	if err := os.MkdirAll(filepath.Join(dir, "src", src.ImportPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{".core-init", ".core-env"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pidFile := filepath.Join(dir, "spot_watch")
+	data := templateData{
+		GoPath:    dir,
+		Source:    src,
+		Go:        goToolchain{Version: "1.21.0"},
+		Count:     1,
+		SpotWatch: true,
+		// The hook fails once it's noted the watcher, the script has to stop the watcher on its way out.
+		PreBench: "echo $spot_watch > " + shellQuote(pidFile) + "\nexit 3",
+	}
+
+	script := render("bench", data)
+	trap := "spot_watch=$!\ntrap 'kill $spot_watch 2>/dev/null' EXIT\n"
+	if !strings.Contains(script, trap) {
+		t.Errorf("the watcher isn't killed on exit:\n%s", script)
+	}
+	if strings.Count(script, "kill $spot_watch") != 1 {
+		t.Errorf("the watcher is killed other than by the trap:\n%s", script)
+	}
+
+	if err := exec.Command("bash", "-c", script).Run(); err == nil {
+		t.Fatal("the script succeeded with a failing pre-bench hook")
+	}
+	pid, err := ioutil.ReadFile(pidFile)
+	if err != nil {
+		t.Fatalf("the pre-bench hook didn't run: %s", err)
+	}
+	stat := filepath.Join("/proc", strings.TrimSpace(string(pid)), "stat")
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		// An orphan that's been killed is either gone or a zombie waiting to be reaped.
+		data, err := ioutil.ReadFile(stat)
+		if err != nil || strings.Contains(string(data), ") Z ") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the spot watcher %s is still running after the script exited", pid)
+		}
+	}
+}
+
+func TestPackageDirMajorVersion(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh isn't installed")
+	}
+	tests := []struct {
+		name string
+		// goMod is the checkout's root go.mod, there's none when it's empty.
+		goMod string
+		want  string
+	}{
+		{"major branch", "module github.com/o/r/v2\n\ngo 1.21\n", "src/github.com/o/r/bench"},
+		{"major branch quoted", "// comment\nmodule \"github.com/o/r/v2\" // v2\n", "src/github.com/o/r/bench"},
+		{"major subdirectory", "module github.com/o/r\n", "src/github.com/o/r/v2/bench"},
+		{"other major version", "module github.com/o/r/v3\n", "src/github.com/o/r/v2/bench"},
+		{"longer module path", "module github.com/o/r/v2x\n", "src/github.com/o/r/v2/bench"},
+		{"no go.mod", "", "src/github.com/o/r/v2/bench"},
+	}
+
+	for _, tt := range tests {
+		gopath := t.TempDir()
+		data := templateData{Source: &repo.Source{ImportPath: "github.com/o/r/v2/bench", Root: "github.com/o/r"}}
+		checkout := filepath.Join(gopath, "src", data.Source.Root)
+		if err := os.MkdirAll(checkout, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if tt.goMod != "" {
+			if err := ioutil.WriteFile(filepath.Join(checkout, "go.mod"), []byte(tt.goMod), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// The benchmarks run in a later session, which only has what's recorded in .core-env.
+		script := data.MajorDir() + "\nunset " + majorDirVar + "\n. $GOPATH/.core-env\necho " + data.PackageDir()
+		cmd := exec.Command("sh", "-c", script)
+		cmd.Env = append(os.Environ(), "GOPATH="+gopath)
+		out, err := cmd.Output()
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if got := strings.TrimSpace(string(out)); got != filepath.Join(gopath, tt.want) {
+			t.Errorf("%s: got %s, want %s", tt.name, got, filepath.Join(gopath, tt.want))
+		}
+	}
+
+	// Without a major version there's nothing to work out.
+	data := templateData{Source: &repo.Source{ImportPath: "github.com/o/r/v1/bench", Root: "github.com/o/r"}}
+	if got := data.PackageDir(); got != "$GOPATH/src/github.com/o/r/v1/bench" {
+		t.Errorf("v1: got %s", got)
+	}
+}
@@ -0,0 +1,132 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2018 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package repo
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Benchmarks counts the benchmark functions the -bench regex matches in the local directory's package, or in the
+// packages the patterns match relative to it. Only the source is read, build constraints aren't evaluated.
+func (s *Source) Benchmarks(bench string, patterns []string) (int, error) {
+	if s.Local == "" {
+		return 0, fmt.Errorf("%s isn't a local directory", s.Origin())
+	}
+	// A slash separates the regex for sub-benchmarks, the functions themselves are matched by what's before it.
+	re, err := regexp.Compile(strings.SplitN(bench, "/", 2)[0])
+	if err != nil {
+		return 0, err
+	}
+
+	dir := filepath.Join(s.Local, filepath.FromSlash(s.Subdir()))
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+	var dirs []string
+	for _, pattern := range patterns {
+		recursive := pattern == "..." || strings.HasSuffix(pattern, "/...")
+		root := filepath.Join(dir, filepath.FromSlash(strings.TrimSuffix(strings.TrimSuffix(pattern, "..."), "/")))
+		if !recursive {
+			dirs = append(dirs, root)
+			continue
+		}
+		err := filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !fi.IsDir() {
+				return nil
+			}
+			// The same directories go's ... wildcard leaves out.
+			name := fi.Name()
+			if path != root && (name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			dirs = append(dirs, path)
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	var count int
+	seen := make(map[string]bool)
+	for _, d := range dirs {
+		if seen[d] {
+			continue
+		}
+		seen[d] = true
+		n, err := countBenchmarks(d, re)
+		if err != nil {
+			return 0, err
+		}
+		count += n
+	}
+	if count == 0 {
+		return 0, fmt.Errorf("no benchmarks matching %q were found in %s", bench, dir)
+	}
+	return count, nil
+}
+
+// countBenchmarks counts the benchmark functions the regex matches in the directory's test files.
+func countBenchmarks(dir string, re *regexp.Regexp) (int, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*_test.go"))
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	fset := token.NewFileSet()
+	for _, file := range files {
+		f, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			return 0, err
+		}
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if ok && fn.Recv == nil && isBenchmark(fn.Name.Name) && re.MatchString(fn.Name.Name) {
+				count++
+			}
+		}
+	}
+	return count, nil
+}
+
+// isBenchmark is go test's rule for benchmark names: Benchmark followed by nothing or by anything but a lower
+// case letter.
+func isBenchmark(name string) bool {
+	if !strings.HasPrefix(name, "Benchmark") {
+		return false
+	}
+	r, _ := utf8.DecodeRuneInString(name[len("Benchmark"):])
+	return !unicode.IsLower(r)
+}
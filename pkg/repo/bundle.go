@@ -0,0 +1,290 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2018 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package repo
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"go/build"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// localRootPrefix is the import path root of a local directory that has no module path of its own.
+const localRootPrefix = "corebench.local/"
+
+// modulePath matches the module directive of a go.mod.
+var modulePath = regexp.MustCompile(`(?m)^module\s+"?([^"\s]+)"?`)
+
+// IsLocal reports whether the path names a directory on this machine rather than a repository to clone.
+func IsLocal(p string) bool {
+	return p == "." || p == ".." || strings.HasPrefix(p, "./") || strings.HasPrefix(p, "../") ||
+		strings.HasPrefix(p, "~/") || filepath.IsAbs(p)
+}
+
+// resolveLocal bundles up the directory from the root of the git repository it's in, or just the directory
+// when it isn't in one. The root keeps the import path it has locally so GOPATH mode still builds it.
+func resolveLocal(dir string) (*Source, error) {
+	if strings.HasPrefix(dir, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		dir = filepath.Join(home, dir[2:])
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if fi, err := os.Stat(dir); err != nil {
+		return nil, err
+	} else if !fi.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+
+	src := &Source{Local: dir}
+	if top, err := git(dir, "rev-parse", "--show-toplevel"); err == nil {
+		src.Local = top
+		src.git = true
+		src.Commit, _ = git(top, "rev-parse", "HEAD")
+		src.Describe, _ = git(top, "describe", "--tags", "--always", "--dirty")
+	}
+
+	src.Root = localImportPath(src.Local)
+	rel, err := filepath.Rel(src.Local, dir)
+	if err != nil {
+		return nil, err
+	}
+	src.ImportPath = path.Join(src.Root, filepath.ToSlash(rel))
+	return src, nil
+}
+
+// localImportPath is the import path of the directory: its module path, its path within GOPATH, or
+// failing that a made up one.
+func localImportPath(dir string) string {
+	if data, err := ioutil.ReadFile(filepath.Join(dir, "go.mod")); err == nil {
+		if m := modulePath.FindSubmatch(data); m != nil {
+			return string(m[1])
+		}
+	}
+	for _, gopath := range filepath.SplitList(build.Default.GOPATH) {
+		if rel, err := filepath.Rel(filepath.Join(gopath, "src"), dir); err == nil && !strings.HasPrefix(rel, "..") && rel != "." {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return localRootPrefix + filepath.Base(dir)
+}
+
+// Bundle writes the local directory as a gzipped tarball. Within a git repository it's every file that's
+// tracked or untracked but not ignored, including uncommitted changes and its submodules' files. The vendor
+// directory is left out, the dependencies are downloaded on the instance, unless vendor is set in which case
+// it's included even when it's ignored.
+func (s *Source) Bundle(w io.Writer, vendor bool) error {
+	files, err := s.files(vendor)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, name := range files {
+		if err := addFile(tw, s.Local, name); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// files lists the files to bundle relative to the local directory, slash separated.
+func (s *Source) files(vendor bool) ([]string, error) {
+	var files []string
+	if s.git {
+		var err error
+		if files, err = gitFiles(s.Local); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if files, err = s.walk("."); err != nil {
+			return nil, err
+		}
+	}
+
+	var bundled []string
+	for _, name := range files {
+		if name == "" || name == "vendor" || strings.HasPrefix(name, "vendor/") {
+			continue
+		}
+		bundled = append(bundled, name)
+	}
+	if vendor {
+		if _, err := os.Stat(filepath.Join(s.Local, "vendor")); err == nil {
+			vendored, err := s.walk("vendor")
+			if err != nil {
+				return nil, err
+			}
+			bundled = append(bundled, vendored...)
+		}
+	}
+	sort.Strings(bundled)
+	return bundled, nil
+}
+
+// gitFiles lists the tracked and untracked but not ignored files of the repository in the directory, slash
+// separated. Submodules are listed as directories, so their files are listed in their place.
+func gitFiles(dir string) ([]string, error) {
+	out, err := git(dir, "ls-files", "-z", "--cached", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+	modules, err := submodules(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, name := range strings.Split(out, "\x00") {
+		if !modules[name] {
+			files = append(files, name)
+			continue
+		}
+		sub := filepath.Join(dir, filepath.FromSlash(name))
+		if _, err := os.Stat(filepath.Join(sub, ".git")); err != nil {
+			return nil, fmt.Errorf("submodule %s isn't checked out, run git submodule update --init --recursive", name)
+		}
+		subFiles, err := gitFiles(sub)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range subFiles {
+			if f != "" {
+				files = append(files, name+"/"+f)
+			}
+		}
+	}
+	return files, nil
+}
+
+// submodules are the paths of the submodules of the repository in the directory, which git tracks as
+// commits rather than files.
+func submodules(dir string) (map[string]bool, error) {
+	out, err := git(dir, "ls-files", "-z", "--stage")
+	if err != nil {
+		return nil, err
+	}
+	modules := make(map[string]bool)
+	for _, entry := range strings.Split(out, "\x00") {
+		if i := strings.IndexByte(entry, '\t'); i >= 0 && strings.HasPrefix(entry, "160000 ") {
+			modules[entry[i+1:]] = true
+		}
+	}
+	return modules, nil
+}
+
+// walk lists every file below the directory within the local directory, slash separated.
+func (s *Source) walk(dir string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(filepath.Join(s.Local, dir), func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() && fi.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if !fi.IsDir() {
+			rel, err := filepath.Rel(s.Local, p)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	return files, err
+}
+
+// addFile writes a single file or symlink to the tarball, a tracked file that's been deleted is skipped.
+func addFile(tw *tar.Writer, root, name string) error {
+	p := filepath.Join(root, filepath.FromSlash(name))
+	fi, err := os.Lstat(p)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var link string
+	switch {
+	case fi.Mode().IsRegular():
+	case fi.Mode()&os.ModeSymlink != 0:
+		if link, err = os.Readlink(p); err != nil {
+			return err
+		}
+	default:
+		return nil
+	}
+
+	hdr, err := tar.FileInfoHeader(fi, link)
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// git runs a git command in the directory and returns its trimmed output.
+func git(dir string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %s", strings.Join(args, " "), strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
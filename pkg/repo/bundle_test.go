@@ -0,0 +1,285 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2018 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package repo
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// runGit runs git in the directory as a user of its own, so the tests don't depend on the machine's config.
+func runGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-c", "protocol.file.allow=always", "-c", "init.defaultBranch=main"}, args...)...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_NOSYSTEM=1",
+		"GIT_AUTHOR_NAME=corebench", "GIT_AUTHOR_EMAIL=corebench@example.com",
+		"GIT_COMMITTER_NAME=corebench", "GIT_COMMITTER_EMAIL=corebench@example.com")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %s: %s\n%s", strings.Join(args, " "), err, out)
+	}
+}
+
+// writeFiles writes the files, given by their slash separated paths, below the directory.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, contents := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// testRepo creates a repository with ignored, untracked and deleted files, an ignored vendor directory, a
+// symlink and a submodule, and returns its directory.
+func testRepo(t *testing.T) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+	dir := t.TempDir()
+
+	lib := filepath.Join(dir, "lib")
+	writeFiles(t, lib, map[string]string{
+		"lib.go":      "package lib\n",
+		"lib_test.go": "package lib\n\nimport \"testing\"\n\nfunc BenchmarkLib(b *testing.B) {}\n",
+	})
+	runGit(t, lib, "init", "-q")
+	runGit(t, lib, "add", "-A")
+	runGit(t, lib, "commit", "-qm", "lib")
+
+	repo := filepath.Join(dir, "repo")
+	writeFiles(t, repo, map[string]string{
+		".gitignore": "*.out\nvendor/\n",
+		"go.mod":     "module example.com/repo\n",
+		"repo.go":    "package repo\n",
+		"repo_test.go": `package repo
+
+import "testing"
+
+type T struct{}
+
+func (T) BenchmarkMethod(b *testing.B) {}
+
+func BenchmarkEncode(b *testing.B)       {}
+func BenchmarkEncodeLarge(b *testing.B)  {}
+func BenchmarkDecode(b *testing.B)       {}
+func Benchmark(b *testing.B)             {}
+func Benchmarkhelper(b *testing.B)       {}
+func TestEncode(t *testing.T)            {}
+`,
+		"sub/sub_test.go":           "package sub\n\nimport \"testing\"\n\nfunc BenchmarkSub(b *testing.B) {}\n",
+		"sub/deep/deep_test.go":     "package deep\n\nimport \"testing\"\n\nfunc BenchmarkDeep(b *testing.B) {}\n",
+		"sub/testdata/x_test.go":    "package x\n\nimport \"testing\"\n\nfunc BenchmarkTestdata(b *testing.B) {}\n",
+		"sub/_skipped/x_test.go":    "package x\n\nimport \"testing\"\n\nfunc BenchmarkSkipped(b *testing.B) {}\n",
+		"deleted.go":                "package repo\n",
+		"vendor/example.com/d/d.go": "package d\n",
+	})
+	if err := os.Symlink("repo.go", filepath.Join(repo, "link.go")); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, repo, "init", "-q")
+	runGit(t, repo, "add", "-A")
+	runGit(t, repo, "submodule", "add", "-q", lib, "third_party/lib")
+	runGit(t, repo, "commit", "-qm", "repo")
+
+	// Uncommitted changes: an ignored file, an untracked one, a deleted one and one in the submodule.
+	writeFiles(t, repo, map[string]string{
+		"cpu.out":                "profile\n",
+		"new.go":                 "package repo\n",
+		"third_party/lib/new.go": "package lib\n",
+	})
+	if err := os.Remove(filepath.Join(repo, "deleted.go")); err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+// bundled lists what's in the bundle, symlinks with their target.
+func bundled(t *testing.T, src *Source, vendor bool) []string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := src.Bundle(&buf, vendor); err != nil {
+		t.Fatalf("Bundle: %s", err)
+	}
+	gz, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := hdr.Name
+		if hdr.Typeflag == tar.TypeSymlink {
+			name += " -> " + hdr.Linkname
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestBundle(t *testing.T) {
+	repo := testRepo(t)
+	src, err := Resolve(context.Background(), filepath.Join(repo, "sub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if src.Local != repo || src.Root != "example.com/repo" || src.ImportPath != "example.com/repo/sub" || src.Commit == "" {
+		t.Fatalf("got %s in %s from %s at %q", src.ImportPath, src.Root, src.Local, src.Commit)
+	}
+
+	files := []string{
+		".gitignore",
+		".gitmodules",
+		"go.mod",
+		"link.go -> repo.go",
+		"new.go",
+		"repo.go",
+		"repo_test.go",
+		"sub/_skipped/x_test.go",
+		"sub/deep/deep_test.go",
+		"sub/sub_test.go",
+		"sub/testdata/x_test.go",
+		"third_party/lib/lib.go",
+		"third_party/lib/lib_test.go",
+		"third_party/lib/new.go",
+	}
+	if got := bundled(t, src, false); !reflect.DeepEqual(got, files) {
+		t.Errorf("without vendor: got %q, want %q", got, files)
+	}
+
+	withVendor := append(append([]string(nil), files...), "vendor/example.com/d/d.go")
+	if got := bundled(t, src, true); !reflect.DeepEqual(got, withVendor) {
+		t.Errorf("with vendor: got %q, want %q", got, withVendor)
+	}
+}
+
+func TestBundleSubmoduleNotCheckedOut(t *testing.T) {
+	repo := testRepo(t)
+	clone := filepath.Join(filepath.Dir(repo), "clone")
+	runGit(t, filepath.Dir(repo), "clone", "-q", repo, clone)
+
+	src, err := Resolve(context.Background(), clone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = src.Bundle(ioutil.Discard, false)
+	if err == nil || !strings.Contains(err.Error(), "submodule third_party/lib isn't checked out") {
+		t.Errorf("got error %v, want one naming the submodule", err)
+	}
+}
+
+func TestBundleWithoutGit(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"main.go":       "package main\n",
+		"cpu.out":       "profile\n",
+		".git/HEAD":     "ref: refs/heads/main\n",
+		"pkg/pkg.go":    "package pkg\n",
+		"vendor/d/d.go": "package d\n",
+	})
+	src, err := Resolve(context.Background(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if src.Commit != "" || !strings.HasPrefix(src.Root, localRootPrefix) {
+		t.Fatalf("got %s at %q for a directory outside of git", src.Root, src.Commit)
+	}
+
+	// Outside of git nothing is ignored, but the .git directory and vendor still are.
+	want := []string{"cpu.out", "main.go", "pkg/pkg.go"}
+	if got := bundled(t, src, false); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestBenchmarks(t *testing.T) {
+	repo := testRepo(t)
+	tests := []struct {
+		dir      string
+		bench    string
+		patterns []string
+		want     int
+		// wantErr is part of the error expected, there's no error when it's empty.
+		wantErr string
+	}{
+		{"", ".", nil, 4, ""},
+		{"", "Encode", nil, 2, ""},
+		{"", "^BenchmarkEncode$", nil, 1, ""},
+		{"", "Encode/small", nil, 2, ""},
+		{"", ".", []string{"./..."}, 7, ""},
+		{"", ".", []string{"./sub/..."}, 2, ""},
+		{"", ".", []string{".", "./sub", "."}, 5, ""},
+		{"sub", ".", nil, 1, ""},
+		{"sub", ".", []string{"./..."}, 2, ""},
+		{"", "Nothing", nil, 0, "no benchmarks matching"},
+		{"", "[", nil, 0, "missing closing ]"},
+	}
+
+	for _, tt := range tests {
+		src, err := Resolve(context.Background(), filepath.Join(repo, tt.dir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := src.Benchmarks(tt.bench, tt.patterns)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%q %q %q: got error %v, want one containing %q", tt.dir, tt.bench, tt.patterns, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q %q %q: unexpected error: %s", tt.dir, tt.bench, tt.patterns, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%q %q %q: got %d benchmarks, want %d", tt.dir, tt.bench, tt.patterns, got, tt.want)
+		}
+	}
+
+	if _, err := (&Source{CloneURL: "https://github.com/o/r"}).Benchmarks(".", nil); err == nil {
+		t.Error("counted the benchmarks of a repository that isn't local")
+	}
+}
@@ -0,0 +1,284 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2018 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+// Package repo works out where the repository under test is cloned from and which directory
+// of it holds the benchmarks, given either a go import path or a git url.
+package repo
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// knownHosts are the code hosts whose repositories are always host/owner/repo, so they're cloned
+// without asking the host where the repository lives.
+var knownHosts = map[string]bool{
+	"github.com":    true,
+	"gitlab.com":    true,
+	"bitbucket.org": true,
+}
+
+// Source is a repository to clone and the package within it to benchmark.
+type Source struct {
+	// ImportPath is the import path of the package to benchmark.
+	ImportPath string
+	// Root is the import path of the repository's root.
+	Root string
+	// CloneURL is what git clones the repository from.
+	CloneURL string
+	// Ref is the branch, tag, commit or pull request to check out, the default branch when empty.
+	Ref string
+	// Refspec is what's fetched from the remote to check out the Ref.
+	Refspec string
+	// Base is the revision the Ref is compared against, there's nothing to compare when empty.
+	Base string
+	// BaseRefspec is what's fetched from the remote to check out the Base.
+	BaseRefspec string
+	// Local is the directory on this machine that's uploaded instead of cloning a repository.
+	Local string
+	// Commit and Describe identify what was checked out locally, they're empty outside of a git repository.
+	Commit   string
+	Describe string
+	// Private is cloned over corebench's ssh session with credentials from this machine, rather than
+	// by the bootstrap which has none.
+	Private bool
+	// git is whether the Local directory is a git repository.
+	git bool
+}
+
+// Host is the host the repository is cloned from.
+func (s *Source) Host() string {
+	return strings.SplitN(urlImportPath(s.CloneURL), "/", 2)[0]
+}
+
+// Owner is the host and owner of the repository, the repositories next to it likely need the same credentials.
+func (s *Source) Owner() string {
+	parts := strings.Split(s.Root, "/")
+	if len(parts) < 2 {
+		return s.Root
+	}
+	return parts[0] + "/" + parts[1]
+}
+
+// Origin is where the source comes from, for display.
+func (s *Source) Origin() string {
+	if s.Local != "" {
+		return s.Local
+	}
+	return s.CloneURL
+}
+
+// pullRequestRef matches GitHub style pull request numbers, #123 or pull/123.
+var pullRequestRef = regexp.MustCompile(`^(?:#|pull/)(\d+)$`)
+
+// validRef matches the characters a branch, tag or commit is given with, anything the shell
+// could interpret is refused since the ref ends up in the bootstrap script. Like git, it refuses
+// empty path elements.
+var validRef = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._+-]*(/[A-Za-z0-9._+-]+)*$`)
+
+// SetRef checks out the ref instead of the default branch.
+func (s *Source) SetRef(ref string) error {
+	refspec, err := refspec(ref)
+	if err != nil {
+		return err
+	}
+	s.Ref, s.Refspec = ref, refspec
+	return nil
+}
+
+// SetBase checks out the ref alongside the Ref to compare against it.
+func (s *Source) SetBase(ref string) error {
+	refspec, err := refspec(ref)
+	if err != nil {
+		return err
+	}
+	s.Base, s.BaseRefspec = ref, refspec
+	return nil
+}
+
+// refspec returns what's fetched from the remote to check out the ref. Pull requests are fetched from
+// the pull/{number}/head refs GitHub keeps for them, anything else is fetched by its name.
+func refspec(ref string) (string, error) {
+	if m := pullRequestRef.FindStringSubmatch(ref); m != nil {
+		return "pull/" + m[1] + "/head", nil
+	}
+	if !validRef.MatchString(ref) || strings.Contains(ref, "..") {
+		return "", fmt.Errorf("%q is not a branch, tag, commit or pull request", ref)
+	}
+	return ref, nil
+}
+
+// Subdir is the directory of the package within the repository, empty for the root.
+func (s *Source) Subdir() string {
+	return strings.TrimPrefix(strings.TrimPrefix(s.ImportPath, s.Root), "/")
+}
+
+// majorVersion matches the major version suffix of a module path, which starts at v2.
+var majorVersion = regexp.MustCompile(`^v([2-9]|[1-9][0-9]+)$`)
+
+// MajorVersion is the major version suffix right after the root in the import path, v2 for
+// github.com/foo/bar/v2/baz, or empty when there's none. It's a directory of the repository in the major
+// subdirectory layout, but not in the major branch layout where the root go.mod declares github.com/foo/bar/v2.
+func (s *Source) MajorVersion() string {
+	if first := strings.SplitN(s.Subdir(), "/", 2)[0]; majorVersion.MatchString(first) {
+		return first
+	}
+	return ""
+}
+
+// Resolve works out where to clone the repository from. Git urls are cloned as they are, repositories on the
+// well known hosts are cloned over https, and anything else is treated as a vanity import path whose
+// repository is looked up the same way the go command does. A local directory is uploaded instead.
+func Resolve(ctx context.Context, path string) (*Source, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return nil, fmt.Errorf("no repository was given")
+	}
+
+	if IsLocal(path) {
+		return resolveLocal(path)
+	}
+
+	if strings.Contains(path, "://") || strings.HasPrefix(path, "git@") {
+		root := urlImportPath(path)
+		return &Source{
+			ImportPath: root,
+			Root:       root,
+			CloneURL:   path,
+		}, nil
+	}
+
+	path = strings.TrimSuffix(path, "/")
+	parts := strings.Split(path, "/")
+
+	// An explicit .git suffix marks the root of the repository, as it does for the go command.
+	for i, part := range parts {
+		if strings.HasSuffix(part, ".git") && i > 0 {
+			root := strings.Join(parts[:i+1], "/")
+			importPath := strings.Join(append([]string{strings.TrimSuffix(root, ".git")}, parts[i+1:]...), "/")
+			return &Source{
+				ImportPath: importPath,
+				Root:       strings.TrimSuffix(root, ".git"),
+				CloneURL:   "https://" + root,
+			}, nil
+		}
+	}
+
+	if knownHosts[parts[0]] {
+		if len(parts) < 3 {
+			return nil, fmt.Errorf("%q is not a repository, expected %s/{owner}/{repo}", path, parts[0])
+		}
+		root := strings.Join(parts[:3], "/")
+		return &Source{
+			ImportPath: path,
+			Root:       root,
+			CloneURL:   "https://" + root,
+		}, nil
+	}
+
+	return resolveVanity(ctx, path)
+}
+
+// goImportMeta matches the <meta name="go-import" content="prefix vcs repo"> tags served for vanity import paths.
+var goImportMeta = regexp.MustCompile(`(?is)<meta\s+name=["']go-import["']\s+content=["']([^"']+)["']`)
+
+// vanityClient looks vanity import paths up, tests trust their own server with it.
+var vanityClient = http.DefaultClient
+
+// resolveVanity asks the server behind an import path where its repository lives.
+func resolveVanity(ctx context.Context, path string) (*Source, error) {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodGet, "https://"+path+"?go-get=1", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := vanityClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up the repository of %q: %s", path, err)
+	}
+	defer resp.Body.Close()
+
+	// The tags live in the head so there's no need to read a whole page.
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up the repository of %q: %s", path, err)
+	}
+
+	for _, match := range goImportMeta.FindAllStringSubmatch(string(body), -1) {
+		fields := strings.Fields(match[1])
+		if len(fields) != 3 {
+			continue
+		}
+		prefix, vcs, cloneURL := fields[0], fields[1], fields[2]
+		if path != prefix && !strings.HasPrefix(path, prefix+"/") {
+			continue
+		}
+		if vcs != "git" {
+			return nil, fmt.Errorf("%q is hosted in %s, only git repositories are supported", path, vcs)
+		}
+		return &Source{
+			ImportPath: path,
+			Root:       prefix,
+			CloneURL:   cloneURL,
+		}, nil
+	}
+	return nil, fmt.Errorf("%q is not a go import path, no go-import meta tag was found", path)
+}
+
+// urlImportPath turns a git url into the import path it would have, which is where it's checked out.
+func urlImportPath(url string) string {
+	path := url
+	if i := strings.Index(path, "://"); i >= 0 {
+		path = path[i+3:]
+	}
+	// Drop any credentials, and turn the scp like git@host:owner/repo syntax into a path.
+	if i := strings.LastIndex(path, "@"); i >= 0 {
+		path = path[i+1:]
+	}
+	if i := strings.Index(path, ":"); i >= 0 && !strings.Contains(path[:i], "/") {
+		path = path[:i] + "/" + strings.TrimPrefix(path[i+1:], "/")
+		// A port number isn't part of the path.
+		if j := strings.Index(path[i+1:], "/"); j >= 0 && isDigits(path[i+1:i+1+j]) {
+			path = path[:i] + path[i+1+j:]
+		}
+	}
+	return strings.TrimPrefix(strings.TrimSuffix(strings.TrimSuffix(path, "/"), ".git"), "/")
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,108 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2018 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+package ssh
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/ssh"
+)
+
+const openSSHKeyMagic = "openssh-key-v1\x00"
+
+// GenerateKeyPair creates a new ed25519 key pair. The public key is returned in the authorized_keys
+// format and the private key is PEM encoded in the OpenSSH format understood by the ssh client.
+func GenerateKeyPair(comment string) (publicKey []byte, privateKey []byte, err error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	privBlock, err := marshalOpenSSHPrivateKey(sshPub, pub, priv, comment)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ssh.MarshalAuthorizedKey(sshPub), pem.EncodeToMemory(privBlock), nil
+}
+
+// marshalOpenSSHPrivateKey encodes an unencrypted ed25519 key as described in OpenSSH's PROTOCOL.key.
+func marshalOpenSSHPrivateKey(sshPub ssh.PublicKey, pub ed25519.PublicKey, priv ed25519.PrivateKey, comment string) (*pem.Block, error) {
+	// The matching check ints let ssh detect a wrong passphrase, they're random even when unencrypted.
+	var checkBytes [4]byte
+	if _, err := rand.Read(checkBytes[:]); err != nil {
+		return nil, err
+	}
+	check := binary.BigEndian.Uint32(checkBytes[:])
+
+	privKey := struct {
+		Check1  uint32
+		Check2  uint32
+		Keytype string
+		Pub     []byte
+		Priv    []byte
+		Comment string
+		Pad     []byte `ssh:"rest"`
+	}{
+		Check1:  check,
+		Check2:  check,
+		Keytype: ssh.KeyAlgoED25519,
+		Pub:     pub,
+		Priv:    priv,
+		Comment: comment,
+	}
+
+	// The private section is padded with 1, 2, 3... up to the cipher block size, 8 for "none".
+	const blockSize = 8
+	unpadded := len(ssh.Marshal(privKey))
+	for i := 0; (unpadded+i)%blockSize != 0; i++ {
+		privKey.Pad = append(privKey.Pad, byte(i+1))
+	}
+
+	key := struct {
+		CipherName   string
+		KdfName      string
+		KdfOpts      string
+		NumKeys      uint32
+		PubKey       []byte
+		PrivKeyBlock []byte
+	}{
+		CipherName:   "none",
+		KdfName:      "none",
+		KdfOpts:      "",
+		NumKeys:      1,
+		PubKey:       sshPub.Marshal(),
+		PrivKeyBlock: ssh.Marshal(privKey),
+	}
+
+	return &pem.Block{
+		Type:  "OPENSSH PRIVATE KEY",
+		Bytes: append([]byte(openSSHKeyMagic), ssh.Marshal(key)...),
+	}, nil
+}
@@ -0,0 +1,157 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2018 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package ssh
+
+import (
+	"bytes"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestGenerateKeyPair(t *testing.T) {
+	pub, priv, err := GenerateKeyPair("corebench-test")
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %s", err)
+	}
+
+	signer, err := ssh.ParsePrivateKey(priv)
+	if err != nil {
+		t.Fatalf("ParsePrivateKey failed on the generated key: %s", err)
+	}
+	if got := ssh.MarshalAuthorizedKey(signer.PublicKey()); !bytes.Equal(got, pub) {
+		t.Errorf("private key's public key = %q, want the .pub output %q", got, pub)
+	}
+
+	parsedPub, comment, _, _, err := ssh.ParseAuthorizedKey(pub)
+	if err != nil {
+		t.Fatalf("ParseAuthorizedKey failed on the generated public key: %s", err)
+	}
+	if parsedPub.Type() != ssh.KeyAlgoED25519 {
+		t.Errorf("public key type = %s, want %s", parsedPub.Type(), ssh.KeyAlgoED25519)
+	}
+	// The comment isn't in the authorized_keys line, it's only kept with the private key.
+	if comment != "" {
+		t.Errorf("public key comment = %q, want none", comment)
+	}
+
+	data := []byte("corebench")
+	sig, err := signer.Sign(nil, data)
+	if err != nil {
+		t.Fatalf("Sign failed: %s", err)
+	}
+	if err := parsedPub.Verify(data, sig); err != nil {
+		t.Errorf("the .pub key doesn't verify the private key's signature: %s", err)
+	}
+}
+
+// TestGenerateKeyPairLayout checks what ssh.ParsePrivateKey doesn't but OpenSSH does: the private section
+// is padded to the block size and the comment survives.
+func TestGenerateKeyPairLayout(t *testing.T) {
+	_, priv, err := GenerateKeyPair("corebench-test")
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %s", err)
+	}
+
+	block, _ := pem.Decode(priv)
+	if block == nil || block.Type != "OPENSSH PRIVATE KEY" {
+		t.Fatalf("private key isn't an OPENSSH PRIVATE KEY pem block: %q", priv)
+	}
+	if !bytes.HasPrefix(block.Bytes, []byte(openSSHKeyMagic)) {
+		t.Fatalf("private key doesn't start with %q", openSSHKeyMagic)
+	}
+
+	var key struct {
+		CipherName   string
+		KdfName      string
+		KdfOpts      string
+		NumKeys      uint32
+		PubKey       []byte
+		PrivKeyBlock []byte
+	}
+	if err := ssh.Unmarshal(block.Bytes[len(openSSHKeyMagic):], &key); err != nil {
+		t.Fatalf("Unmarshal of the key failed: %s", err)
+	}
+	if len(key.PrivKeyBlock)%8 != 0 {
+		t.Errorf("private section is %d bytes, want a multiple of the block size 8", len(key.PrivKeyBlock))
+	}
+
+	var privKey struct {
+		Check1  uint32
+		Check2  uint32
+		Keytype string
+		Pub     []byte
+		Priv    []byte
+		Comment string
+		Pad     []byte `ssh:"rest"`
+	}
+	if err := ssh.Unmarshal(key.PrivKeyBlock, &privKey); err != nil {
+		t.Fatalf("Unmarshal of the private section failed: %s", err)
+	}
+	if privKey.Check1 != privKey.Check2 {
+		t.Errorf("check ints %d and %d don't match", privKey.Check1, privKey.Check2)
+	}
+	if privKey.Comment != "corebench-test" {
+		t.Errorf("comment = %q, want %q", privKey.Comment, "corebench-test")
+	}
+	for i, b := range privKey.Pad {
+		if int(b) != i+1 {
+			t.Fatalf("padding = %v, want 1, 2, 3...", privKey.Pad)
+		}
+	}
+}
+
+// TestGenerateKeyPairOpenSSH has ssh-keygen read the private key back, it's what the ssh client will do.
+func TestGenerateKeyPairOpenSSH(t *testing.T) {
+	keygen, err := exec.LookPath("ssh-keygen")
+	if err != nil {
+		t.Skip("ssh-keygen isn't installed")
+	}
+
+	pub, priv, err := GenerateKeyPair("corebench-test")
+	if err != nil {
+		t.Fatalf("GenerateKeyPair failed: %s", err)
+	}
+
+	dir, err := ioutil.TempDir("", "corebench-keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "id_ed25519")
+	if err := ioutil.WriteFile(path, priv, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := exec.Command(keygen, "-y", "-f", path).CombinedOutput()
+	if err != nil {
+		t.Fatalf("ssh-keygen couldn't read the private key: %s: %s", err, out)
+	}
+	if got, want := bytes.Fields(out), bytes.Fields(pub); len(got) < 2 || !bytes.Equal(got[0], want[0]) || !bytes.Equal(got[1], want[1]) {
+		t.Errorf("ssh-keygen derived public key %q, want %q", out, pub)
+	}
+}
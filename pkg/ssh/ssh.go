@@ -21,15 +21,23 @@ SOFTWARE.
 package ssh
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
 	"os"
 	"os/exec"
 	"strings"
 	"time"
 
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
 )
 
+// hostKeyAlias is what the host key is known as, whichever address the host has.
+const hostKeyAlias = "corebench-host"
+
 var (
 	// sshConfig is mocked out to just attempt connections until we get a handshake failure
 	// at that point we know the connection is ready.
@@ -43,36 +51,91 @@ var (
 	}
 )
 
-// ExecuteSSH executes a single ssh remote command.
-func ExecuteSSH(host string, cmd string) error {
-	var sshArgs []string
-	fmt.Println(sshArgs)
-	if strings.Contains(host, "ubuntu") {
-		sshArgs = []string{
-			"-p", fmt.Sprintf("%d", 22),
-			"-o", "UserKnownHostsFile=/dev/null",
-			"-o", "StrictHostKeyChecking=no",
-			"-o", "LogLevel=quiet",
-			"-i", "corebench.pem",
-			host,
-			cmd, // actual string command to execute.
-		}
-	} else {
-		sshArgs = []string{
-			"-p", fmt.Sprintf("%d", 22),
-			"-o", "UserKnownHostsFile=/dev/null",
-			"-o", "StrictHostKeyChecking=no",
-			"-o", "LogLevel=quiet",
-			host,
-			cmd, // actual string command to execute.
-		}
+// ExecuteSSH executes a single ssh remote command, the command's output is written to stdout.
+// The identity file is used to authenticate when given, otherwise ssh falls back to its defaults.
+// The ssh process is killed when the context is cancelled.
+func ExecuteSSH(ctx context.Context, host, identityFile, cmd string, stdout io.Writer) error {
+	currentCmd := exec.CommandContext(ctx, "ssh", sshArgs(host, identityFile, cmd)...)
+	currentCmd.Stdin = os.Stdin
+	currentCmd.Stderr = os.Stderr
+	currentCmd.Stdout = stdout
+
+	if err := currentCmd.Run(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// UploadSSH executes a single ssh remote command that reads what's uploaded from its stdin. The command's
+// output goes to stderr so it doesn't end up amongst the benchmark results.
+func UploadSSH(ctx context.Context, host, identityFile, cmd string, stdin io.Reader) error {
+	return runSSH(ctx, sshArgs(host, identityFile, cmd), stdin)
+}
+
+// NewKnownHosts creates the empty known hosts file that PinHostSSH records a host's key in, remove it once done.
+func NewKnownHosts() (string, error) {
+	f, err := ioutil.TempFile("", "corebench-known-hosts")
+	if err != nil {
+		return "", err
 	}
+	return f.Name(), f.Close()
+}
 
-	currentCmd := exec.Command("ssh", sshArgs...)
-	// TODO: tee off to a file, if they specificed a file.
-	currentCmd.Stdin = os.Stdin
+// PinHostSSH executes a single remote command like UploadSSH and records the host's key in the knownHosts file.
+// The key is trusted on this first connection, which is why it never forwards the agent.
+func PinHostSSH(ctx context.Context, host, identityFile, knownHosts, cmd string, stdin io.Reader) error {
+	return runSSH(ctx, append(knownHostArgs(knownHosts, "accept-new"), sshArgs(host, identityFile, cmd)...), stdin)
+}
+
+// ForwardAgentSSH executes a single remote command with the local ssh agent forwarded to it, so the command
+// can authenticate as the user without their keys ever leaving this machine. Like UploadSSH its output goes to stderr.
+// Unlike the other commands the host has to prove it holds the key PinHostSSH recorded in knownHosts, otherwise
+// whatever answered in its place could use the agent.
+func ForwardAgentSSH(ctx context.Context, host, identityFile, knownHosts, cmd string, stdin io.Reader) error {
+	args := append([]string{"-A"}, knownHostArgs(knownHosts, "yes")...)
+	return runSSH(ctx, append(args, sshArgs(host, identityFile, cmd)...), stdin)
+}
+
+// knownHostArgs check the host's key against the knownHosts file. ssh keeps the first value it's given for an
+// option, so these win over sshArgs' defaults.
+func knownHostArgs(knownHosts, strict string) []string {
+	return []string{
+		"-o", "HostKeyAlias=" + hostKeyAlias,
+		"-o", "HostKeyAlgorithms=ssh-ed25519",
+		"-o", "UserKnownHostsFile=" + knownHosts,
+		"-o", "StrictHostKeyChecking=" + strict,
+		"-o", "LogLevel=error",
+	}
+}
+
+// CheckAgent makes sure there's a local ssh agent holding at least one key to forward.
+func CheckAgent() error {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return fmt.Errorf("no ssh agent is running, SSH_AUTH_SOCK isn't set")
+	}
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return fmt.Errorf("failed to connect to the ssh agent: %s", err)
+	}
+	defer conn.Close()
+
+	keys, err := agent.NewClient(conn).List()
+	if err != nil {
+		return fmt.Errorf("failed to list the ssh agent's keys: %s", err)
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("the ssh agent holds no keys, add one with ssh-add")
+	}
+	return nil
+}
+
+// runSSH runs ssh with the stdin, sending its output to stderr.
+func runSSH(ctx context.Context, args []string, stdin io.Reader) error {
+	currentCmd := exec.CommandContext(ctx, "ssh", args...)
+	currentCmd.Stdin = stdin
 	currentCmd.Stderr = os.Stderr
-	currentCmd.Stdout = os.Stdout
+	currentCmd.Stdout = os.Stderr
 
 	if err := currentCmd.Run(); err != nil {
 		return err
@@ -80,11 +143,31 @@ func ExecuteSSH(host string, cmd string) error {
 	return nil
 }
 
+// sshArgs are the arguments to run a single remote command with ssh.
+func sshArgs(host, identityFile, cmd string) []string {
+	sshArgs := []string{
+		"-p", fmt.Sprintf("%d", 22),
+		"-o", "UserKnownHostsFile=/dev/null",
+		"-o", "StrictHostKeyChecking=no",
+		"-o", "LogLevel=quiet",
+	}
+	if identityFile != "" {
+		sshArgs = append(sshArgs, "-i", identityFile, "-o", "IdentitiesOnly=yes")
+	}
+	return append(sshArgs,
+		host,
+		cmd, // actual string command to execute.
+	)
+}
+
 // PollSSH dials in a loop waiting to connect, this isn't used for anything other than
 // just to negotiate that the connection is open and will never succeed in authentication.
 // This is used purely to know a server's SSH listener is ready to connect to.
-func PollSSH(host string) error {
+func PollSSH(ctx context.Context, host string) error {
 	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		client, err := ssh.Dial("tcp", host, sshConfig)
 		if err != nil {
 			// Due to Go's error handling semantics...only way I can detect the error is
@@ -0,0 +1,115 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2018 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package ssh
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeSSH stands in for ssh the way it treats known hosts: it takes the first value given for an option, records
+// the host's key with StrictHostKeyChecking=accept-new and refuses a key it doesn't know with yes. Every command
+// line it's run with goes in the log, one per line.
+const fakeSSH = `#!/bin/sh
+echo "$*" >> "$FAKE_SSH_LOG"
+known= strict= alias=
+while [ $# -gt 0 ]; do
+	case "$1" in
+	-o)
+		shift
+		case "$1" in
+		UserKnownHostsFile=*) [ -n "$known" ] || known=${1#*=} ;;
+		StrictHostKeyChecking=*) [ -n "$strict" ] || strict=${1#*=} ;;
+		HostKeyAlias=*) [ -n "$alias" ] || alias=${1#*=} ;;
+		esac
+		;;
+	esac
+	shift
+done
+entry="$alias $FAKE_SSH_HOST_KEY"
+[ "$known" = /dev/null ] && exit 0
+if grep -qxF "$entry" "$known"; then exit 0; fi
+if grep -q "^$alias " "$known"; then exit 255; fi
+if [ "$strict" = accept-new ]; then echo "$entry" >> "$known"; exit 0; fi
+exit 255
+`
+
+func installFakeSSH(t *testing.T) (log string) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "ssh"), []byte(fakeSSH), 0755); err != nil {
+		t.Fatal(err)
+	}
+	log = filepath.Join(dir, "log")
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("FAKE_SSH_LOG", log)
+	t.Setenv("FAKE_SSH_HOST_KEY", "ssh-ed25519 AAAAfirst")
+	return log
+}
+
+func TestForwardAgentOnlyToPinnedHost(t *testing.T) {
+	log := installFakeSSH(t)
+	ctx := context.Background()
+	knownHosts, err := NewKnownHosts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(knownHosts)
+
+	if err := ForwardAgentSSH(ctx, "root@host", "", knownHosts, "true", nil); err == nil {
+		t.Error("the agent was forwarded before the host key was pinned")
+	}
+	if err := PinHostSSH(ctx, "root@host", "", knownHosts, "true", nil); err != nil {
+		t.Fatalf("pinning the host key: %s", err)
+	}
+	if err := ForwardAgentSSH(ctx, "root@host", "", knownHosts, "true", nil); err != nil {
+		t.Errorf("the agent wasn't forwarded to the pinned host: %s", err)
+	}
+	t.Setenv("FAKE_SSH_HOST_KEY", "ssh-ed25519 AAAAsecond")
+	if err := ForwardAgentSSH(ctx, "root@host", "", knownHosts, "true", nil); err == nil {
+		t.Error("the agent was forwarded to a host with another key")
+	}
+	if err := PinHostSSH(ctx, "root@host", "", knownHosts, "true", nil); err == nil {
+		t.Error("the pinned host key was replaced")
+	}
+
+	out, err := ioutil.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(calls) != 5 {
+		t.Fatalf("ssh ran %d times, want 5:\n%s", len(calls), out)
+	}
+	for i, call := range calls {
+		forwarded := strings.HasPrefix(call, "-A ")
+		if pin := i == 1 || i == 4; forwarded == pin {
+			t.Errorf("call %d: forwards the agent %t: %s", i, forwarded, call)
+		}
+		if !strings.Contains(call, "HostKeyAlgorithms=ssh-ed25519") {
+			t.Errorf("call %d: accepts host keys other than ed25519: %s", i, call)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2018 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+// Package toolchain resolves the go version to benchmark with against the official index of go releases,
+// so a version that doesn't exist fails before an instance is paid for rather than minutes into its bootstrap.
+package toolchain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultIndex lists every go release along with the checksums of its archives.
+const DefaultIndex = "https://go.dev/dl/?mode=json&include=all"
+
+// downloadURL is where the archives listed by the index are downloaded from.
+const downloadURL = "https://dl.google.com/go/"
+
+const (
+	// Latest is the newest stable release.
+	Latest = "latest"
+	// Tip is built from the head of the go repository, with the newest stable release.
+	Tip = "tip"
+)
+
+// File is a single download of a release.
+type File struct {
+	Filename string `json:"filename"`
+	OS       string `json:"os"`
+	Arch     string `json:"arch"`
+	Version  string `json:"version"`
+	SHA256   string `json:"sha256"`
+	Size     int64  `json:"size"`
+	Kind     string `json:"kind"`
+}
+
+// URL is where the file is downloaded from.
+func (f File) URL() string {
+	return downloadURL + f.Filename
+}
+
+// Release is a go release as listed by the index.
+type Release struct {
+	Version string `json:"version"`
+	Stable  bool   `json:"stable"`
+	Files   []File `json:"files"`
+}
+
+// Toolchain is the go version resolved for a run.
+type Toolchain struct {
+	// Version is the release, go1.21.5, or tip.
+	Version string
+	// Release is what's installed, tip is built with it.
+	Release Release
+}
+
+// Tip is whether go is built from the head of its repository.
+func (t *Toolchain) Tip() bool {
+	return t.Version == Tip
+}
+
+// Newer is whether the toolchain is a later go than the other, tip is later than any release.
+func (t *Toolchain) Newer(other *Toolchain) bool {
+	if t.Tip() || other.Tip() {
+		return t.Tip() && !other.Tip()
+	}
+	return newer(t.Version, other.Version)
+}
+
+// Archive is the binary distribution of the release for the os and architecture.
+func (t *Toolchain) Archive(goos, goarch string) (File, error) {
+	for _, f := range t.Release.Files {
+		if f.Kind == "archive" && f.OS == goos && f.Arch == goarch {
+			return f, nil
+		}
+	}
+	return File{}, fmt.Errorf("%s has no %s/%s archive", t.Release.Version, goos, goarch)
+}
+
+// Resolver looks versions up in an index of go releases, the index is only fetched once.
+type Resolver struct {
+	// Index is the url of the index, DefaultIndex when empty.
+	Index  string
+	Client *http.Client
+
+	fetched []Release
+}
+
+// Resolve looks the version up in the official index.
+func Resolve(ctx context.Context, version string) (*Toolchain, error) {
+	return (&Resolver{}).Resolve(ctx, version)
+}
+
+// Resolve turns latest, tip, a language version such as 1.21 or an exact release such as 1.21.5 or
+// go1.22rc1 into the release to install. A language version is the latest stable patch release of it.
+func (r *Resolver) Resolve(ctx context.Context, version string) (*Toolchain, error) {
+	version = strings.TrimSpace(version)
+	query := version
+	if query != Latest && query != Tip {
+		query = "go" + strings.TrimPrefix(query, "go")
+		if _, ok := parseVersion(query); !ok {
+			return nil, fmt.Errorf("%q is not a go version, give latest, tip, a release such as 1.21 or 1.21.5", version)
+		}
+	}
+
+	releases, err := r.releases(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var found *Release
+	for i := range releases {
+		if matches(query, releases[i]) && (found == nil || newer(releases[i].Version, found.Version)) {
+			found = &releases[i]
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("%s is not a go release, see https://go.dev/dl/ for the releases", version)
+	}
+	if query == Tip {
+		return &Toolchain{Version: Tip, Release: *found}, nil
+	}
+	return &Toolchain{Version: found.Version, Release: *found}, nil
+}
+
+// matches is whether the release is one the query asks for. Latest and tip both want a stable release,
+// tip is built with it, and a language version wants any of its stable patch releases.
+func matches(query string, release Release) bool {
+	switch query {
+	case Latest, Tip:
+		return release.Stable
+	}
+	if release.Version == query {
+		return true
+	}
+	q, _ := parseVersion(query)
+	v, ok := parseVersion(release.Version)
+	if !ok || q.patch >= 0 || q.pre != "" {
+		return false
+	}
+	return release.Stable && v.major == q.major && v.minor == q.minor
+}
+
+// releases fetches every release in the index.
+func (r *Resolver) releases(ctx context.Context) ([]Release, error) {
+	if r.fetched != nil {
+		return r.fetched, nil
+	}
+	index := r.Index
+	if index == "" {
+		index = DefaultIndex
+	}
+	client := r.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, index, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the go release index: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch the go release index: %s", resp.Status)
+	}
+
+	var releases []Release
+	if err := json.NewDecoder(resp.Body).Decode(&releases); err != nil {
+		return nil, fmt.Errorf("failed to read the go release index: %s", err)
+	}
+	r.fetched = releases
+	return releases, nil
+}
+
+// versionPattern matches release names, go1.9, go1.21.5, go1.22rc1 and go1.4beta1.
+var versionPattern = regexp.MustCompile(`^go(\d+)(?:\.(\d+))?(?:\.(\d+))?(?:(beta|rc)(\d+))?$`)
+
+// version is a parsed release name, patch is -1 when it isn't given.
+type version struct {
+	major, minor, patch int
+	pre                 string
+	preNum              int
+}
+
+func parseVersion(name string) (version, bool) {
+	m := versionPattern.FindStringSubmatch(name)
+	if m == nil {
+		return version{}, false
+	}
+	v := version{patch: -1, pre: m[4]}
+	v.major, _ = strconv.Atoi(m[1])
+	v.minor, _ = strconv.Atoi(m[2])
+	if m[3] != "" {
+		v.patch, _ = strconv.Atoi(m[3])
+	}
+	v.preNum, _ = strconv.Atoi(m[5])
+	return v, true
+}
+
+// newer is whether release a came out after release b, names that don't parse are never newer.
+func newer(a, b string) bool {
+	va, ok := parseVersion(a)
+	if !ok {
+		return false
+	}
+	vb, ok := parseVersion(b)
+	if !ok {
+		return true
+	}
+	if va.major != vb.major {
+		return va.major > vb.major
+	}
+	if va.minor != vb.minor {
+		return va.minor > vb.minor
+	}
+	// A missing patch is the .0 release, its prereleases come before it.
+	pa, pb := va.patch, vb.patch
+	if pa < 0 {
+		pa = 0
+	}
+	if pb < 0 {
+		pb = 0
+	}
+	if pa != pb {
+		return pa > pb
+	}
+	if va.pre != vb.pre {
+		return preRank[va.pre] > preRank[vb.pre]
+	}
+	return va.preNum > vb.preNum
+}
+
+// preRank orders the prereleases of a version before the version itself.
+var preRank = map[string]int{"beta": 0, "rc": 1, "": 2}
@@ -0,0 +1,166 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2018 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package toolchain
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testIndex is a small index in the format go.dev/dl serves, out of order like the real one can be.
+const testIndex = `[
+  {"version": "go1.22rc1", "stable": false, "files": [
+    {"filename": "go1.22rc1.linux-amd64.tar.gz", "os": "linux", "arch": "amd64", "version": "go1.22rc1", "sha256": "e0", "kind": "archive"}]},
+  {"version": "go1.21.5", "stable": true, "files": [
+    {"filename": "go1.21.5.src.tar.gz", "os": "", "arch": "", "version": "go1.21.5", "sha256": "a0", "kind": "source"},
+    {"filename": "go1.21.5.linux-amd64.tar.gz", "os": "linux", "arch": "amd64", "version": "go1.21.5", "sha256": "a1", "kind": "archive"},
+    {"filename": "go1.21.5.linux-arm64.tar.gz", "os": "linux", "arch": "arm64", "version": "go1.21.5", "sha256": "a2", "kind": "archive"}]},
+  {"version": "go1.20.12", "stable": true, "files": [
+    {"filename": "go1.20.12.linux-amd64.tar.gz", "os": "linux", "arch": "amd64", "version": "go1.20.12", "sha256": "b1", "kind": "archive"}]},
+  {"version": "go1.21.0", "stable": true, "files": [
+    {"filename": "go1.21.0.linux-amd64.tar.gz", "os": "linux", "arch": "amd64", "version": "go1.21.0", "sha256": "c1", "kind": "archive"}]},
+  {"version": "go1.20", "stable": true, "files": [
+    {"filename": "go1.20.linux-amd64.tar.gz", "os": "linux", "arch": "amd64", "version": "go1.20", "sha256": "d1", "kind": "archive"}]},
+  {"version": "go1.9.2rc2", "stable": false, "files": []}
+]`
+
+func testResolver(t *testing.T) *Resolver {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("mode") != "json" {
+			http.Error(w, "mode=json is required", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(testIndex))
+	}))
+	t.Cleanup(srv.Close)
+	return &Resolver{Index: srv.URL + "/dl/?mode=json&include=all", Client: srv.Client()}
+}
+
+func TestResolve(t *testing.T) {
+	r := testResolver(t)
+	tests := []struct {
+		version string
+		want    string
+		tip     bool
+	}{
+		{"latest", "go1.21.5", false},
+		{"tip", "go1.21.5", true},
+		{"1.21", "go1.21.5", false},
+		{"go1.21", "go1.21.5", false},
+		{"1.20", "go1.20.12", false},
+		{"1.21.0", "go1.21.0", false},
+		{"go1.20", "go1.20.12", false},
+		{"1.22rc1", "go1.22rc1", false},
+	}
+	for _, tt := range tests {
+		tc, err := r.Resolve(context.Background(), tt.version)
+		if err != nil {
+			t.Errorf("Resolve(%q) failed: %s", tt.version, err)
+			continue
+		}
+		if tc.Release.Version != tt.want || tc.Tip() != tt.tip {
+			t.Errorf("Resolve(%q) = %s (tip %v), want %s (tip %v)", tt.version, tc.Release.Version, tc.Tip(), tt.want, tt.tip)
+		}
+	}
+}
+
+func TestResolveUnknown(t *testing.T) {
+	r := testResolver(t)
+	tests := []struct {
+		version string
+		err     string
+	}{
+		{"1.99.1", "is not a go release"},
+		{"1.22", "is not a go release"},
+		{"1.9.2", "is not a go release"},
+		{"1.21.x", "is not a go version"},
+		{"1.21; rm -rf /", "is not a go version"},
+	}
+	for _, tt := range tests {
+		_, err := r.Resolve(context.Background(), tt.version)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Resolve(%q) error = %v, want one containing %q", tt.version, err, tt.err)
+		}
+	}
+}
+
+func TestResolveIndexUnavailable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	_, err := (&Resolver{Index: srv.URL, Client: srv.Client()}).Resolve(context.Background(), "latest")
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("Resolve with the index unavailable returned %v, want a 503 error", err)
+	}
+}
+
+func TestArchive(t *testing.T) {
+	tc, err := testResolver(t).Resolve(context.Background(), "1.21")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := tc.Archive("linux", "arm64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.SHA256 != "a2" || f.URL() != "https://dl.google.com/go/go1.21.5.linux-arm64.tar.gz" {
+		t.Errorf("Archive(linux, arm64) = %+v", f)
+	}
+	if _, err := tc.Archive("linux", "riscv64"); err == nil {
+		t.Error("Archive(linux, riscv64) succeeded, the release has no such archive")
+	}
+}
+
+func TestNewer(t *testing.T) {
+	r := testResolver(t)
+	resolve := func(version string) *Toolchain {
+		tc, err := r.Resolve(context.Background(), version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tc
+	}
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"1.21", "1.20", true},
+		{"1.20", "1.21", false},
+		{"1.22rc1", "1.21.5", true},
+		{"1.21.5", "1.21.0", true},
+		{"1.21.0", "1.21.0", false},
+		{"tip", "1.22rc1", true},
+		{"1.22rc1", "tip", false},
+		{"tip", "tip", false},
+	}
+	for _, tt := range tests {
+		if got := resolve(tt.a).Newer(resolve(tt.b)); got != tt.want {
+			t.Errorf("%s.Newer(%s) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2018 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package utility
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+const (
+	retryInitialBackoff = time.Second
+	retryMaxBackoff     = 30 * time.Second
+)
+
+// sleep is Sleep, tests replace it to see the waits without sitting through them.
+var sleep = Sleep
+
+type retryAfterError struct {
+	error
+	after time.Duration
+}
+
+// RetryAfter asks Retry to wait at least the given duration before the next attempt, like when rate limited.
+func RetryAfter(err error, after time.Duration) error {
+	return &retryAfterError{err, after}
+}
+
+type permanentError struct {
+	error
+}
+
+// Permanent stops Retry from retrying an error that won't go away by itself.
+func Permanent(err error) error {
+	return &permanentError{err}
+}
+
+// Retry calls fn until it succeeds or the attempts run out, backing off exponentially with jitter in between.
+// The last error is returned unwrapped.
+func Retry(ctx context.Context, attempts int, fn func() error) error {
+	backoff := retryInitialBackoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil {
+			return nil
+		}
+
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff)))
+		switch e := err.(type) {
+		case *permanentError:
+			return e.error
+		case *retryAfterError:
+			err = e.error
+			if e.after > wait {
+				wait = e.after
+			}
+		}
+		if attempt >= attempts {
+			return err
+		}
+
+		if serr := sleep(ctx, wait); serr != nil {
+			return err
+		}
+		if backoff *= 2; backoff > retryMaxBackoff {
+			backoff = retryMaxBackoff
+		}
+	}
+}
@@ -0,0 +1,127 @@
+/*
+Open Source Initiative OSI - The MIT License (MIT):Licensing
+The MIT License (MIT)
+Copyright (c) 2018 Ralph Caraveo (deckarep@gmail.com)
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+of the Software, and to permit persons to whom the Software is furnished to do
+so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package utility
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	errFail := errors.New("fail")
+	tests := []struct {
+		name     string
+		attempts int
+		// errs are returned by the calls in order, the last one is repeated.
+		errs      []error
+		wantErr   error
+		wantCalls int
+		// minWaits are the least Retry must have slept between the calls.
+		minWaits []time.Duration
+	}{
+		{"success", 3, []error{nil}, nil, 1, nil},
+		{"success after failures", 5, []error{errFail, errFail, nil}, nil, 3, []time.Duration{0, 0}},
+		{"permanent", 5, []error{Permanent(errFail)}, errFail, 1, nil},
+		{"permanent after failures", 5, []error{errFail, Permanent(errFail)}, errFail, 2, []time.Duration{0}},
+		{"gives up", 3, []error{errFail}, errFail, 3, []time.Duration{0, 0}},
+		{"single attempt", 1, []error{errFail}, errFail, 1, nil},
+		{"retry after", 3, []error{RetryAfter(errFail, time.Hour), nil}, nil, 2, []time.Duration{time.Hour}},
+		{"retry after gives up", 2, []error{RetryAfter(errFail, time.Hour)}, errFail, 2, []time.Duration{time.Hour}},
+	}
+
+	for _, tt := range tests {
+		var waits []time.Duration
+		sleep = func(ctx context.Context, d time.Duration) error {
+			waits = append(waits, d)
+			return nil
+		}
+		calls := 0
+		err := Retry(context.Background(), tt.attempts, func() error {
+			calls++
+			if calls > len(tt.errs) {
+				return tt.errs[len(tt.errs)-1]
+			}
+			return tt.errs[calls-1]
+		})
+		sleep = Sleep
+
+		if err != tt.wantErr {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if calls != tt.wantCalls {
+			t.Errorf("%s: got %d calls, want %d", tt.name, calls, tt.wantCalls)
+		}
+		if len(waits) != len(tt.minWaits) {
+			t.Errorf("%s: got %d waits, want %d", tt.name, len(waits), len(tt.minWaits))
+			continue
+		}
+		for i, wait := range waits {
+			if wait < tt.minWaits[i] {
+				t.Errorf("%s: wait %d was %s, want at least %s", tt.name, i, wait, tt.minWaits[i])
+			}
+		}
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	var waits []time.Duration
+	sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	t.Cleanup(func() { sleep = Sleep })
+
+	Retry(context.Background(), 10, func() error { return errors.New("fail") })
+	backoff := retryInitialBackoff
+	for i, wait := range waits {
+		if wait < backoff/2 || wait >= backoff/2+backoff {
+			t.Errorf("wait %d was %s, want within [%s, %s)", i, wait, backoff/2, backoff/2+backoff)
+		}
+		if backoff *= 2; backoff > retryMaxBackoff {
+			backoff = retryMaxBackoff
+		}
+	}
+}
+
+func TestRetryCanceled(t *testing.T) {
+	errFail := errors.New("fail")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	calls := 0
+	start := time.Now()
+	err := Retry(ctx, 5, func() error {
+		calls++
+		return RetryAfter(errFail, time.Hour)
+	})
+	if err != errFail {
+		t.Errorf("got error %v, want %v", err, errFail)
+	}
+	if calls != 1 {
+		t.Errorf("got %d calls, want 1", calls)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("returned after %s, want right away", elapsed)
+	}
+}
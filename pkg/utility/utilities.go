@@ -1,9 +1,17 @@
 package utility
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	uuid "github.com/satori/go.uuid"
 )
@@ -17,6 +25,74 @@ func GitPathLast(repo string) string {
 	return ""
 }
 
+// Sleep pauses for the duration, returning early with the context's error when it's cancelled.
+func Sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// callerIPURL responds with the public ip address the request came from.
+var callerIPURL = "https://checkip.amazonaws.com"
+
+// CallerCIDR returns the cidr that ssh access should be restricted to: the configured cidr or ip address
+// when one is given, otherwise the public ip address of this machine as seen from the internet. It has to be
+// IPv4, the instances are only reachable over IPv4.
+func CallerCIDR(configured string) (string, error) {
+	if configured == "" {
+		client := &http.Client{Timeout: 10 * time.Second}
+		resp, err := client.Get(callerIPURL)
+		if err != nil {
+			return "", fmt.Errorf("failed to detect public ip, specify a cidr instead: %s", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("failed to detect public ip, specify a cidr instead: %s responded %s", callerIPURL, resp.Status)
+		}
+
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return "", fmt.Errorf("failed to detect public ip, specify a cidr instead: %s", err)
+		}
+		configured = strings.TrimSpace(string(body))
+	}
+
+	if ip, ipNet, err := net.ParseCIDR(configured); err == nil {
+		if ip.To4() == nil {
+			return "", fmt.Errorf("%q is an IPv6 cidr, the instances are only reachable over IPv4 so give an IPv4 cidr", configured)
+		}
+		return ipNet.String(), nil
+	}
+
+	ip := net.ParseIP(configured)
+	if ip == nil {
+		return "", fmt.Errorf("%q is neither an ip address nor a cidr", configured)
+	}
+	if ip.To4() == nil {
+		return "", fmt.Errorf("%q is an IPv6 address, the instances are only reachable over IPv4 so give an IPv4 address or cidr", configured)
+	}
+	return ip.String() + "/32", nil
+}
+
+// ConfigDir returns a directory under corebench's configuration directory, ~/.corebench,
+// creating it readable by the current user only when it doesn't exist yet.
+func ConfigDir(elem ...string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(append([]string{home, ".corebench"}, elem...)...)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
 // NewInstanceID returns the last component of a V4 Guid, to keep the names reasonably small.
 func NewInstanceID() string {
 	g := uuid.Must(uuid.NewV4())
@@ -24,14 +100,22 @@ func NewInstanceID() string {
 	return p[len(p)-1]
 }
 
-// PromptConfirmation asks the user for confirmation.
+// AssumeYes answers yes to every confirmation prompt so corebench can run non-interactively.
+var AssumeYes bool
+
+// PromptConfirmation asks the user for confirmation, when there's nothing to read the answer is no.
 func PromptConfirmation(msg string) bool {
 	fmt.Println(msg)
+	if AssumeYes {
+		fmt.Println("yes (--yes)")
+		return true
+	}
 
 	var response string
 	_, err := fmt.Scanln(&response)
-	if err != nil {
-		log.Fatal(err)
+	if err == io.EOF {
+		log.Println("No answer could be read, assuming no: use --yes to run non-interactively")
+		return false
 	}
 	okayResponses := []string{"y", "Y", "yes", "Yes", "YES"}
 	nokayResponses := []string{"n", "N", "no", "No", "NO"}